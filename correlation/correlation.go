@@ -0,0 +1,351 @@
+// Package correlation finds the values in a HAR that a replay can't send as
+// they were recorded: tokens, CSRF values and IDs that a server handed out in
+// one response and that the browser sent back in later requests. For each it
+// suggests a transform that captures the live value and uses it instead.
+package correlation
+
+import (
+	"encoding/json"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/JackDanger/traffic/model"
+	"github.com/JackDanger/traffic/persistence"
+	"github.com/JackDanger/traffic/transforms"
+)
+
+// Suggestion is a value that first appeared in a response and was sent back
+// in later requests, with a transform that would replace it when replaying
+type Suggestion struct {
+	Source     string                `json:"source"`      // body, header or cookie
+	Name       string                `json:"name"`        // the JSONPath, header or cookie the value is in
+	EntryIndex int                   `json:"entry_index"` // the entry whose response it first appeared in
+	URL        string                `json:"url"`         // that entry's request URL
+	Values     []string              `json:"values"`      // the recorded values, more than one if the request was repeated
+	Uses       []Use                 `json:"uses"`
+	Transform  persistence.Transform `json:"transform"` // ready to be stored for the archive
+}
+
+// Use is somewhere a value was sent back
+type Use struct {
+	EntryIndex int    `json:"entry_index"`
+	Location   string `json:"location"` // url, body, or the header, cookie or param it's in
+}
+
+// Headers whose values are about the response itself rather than anything a
+// later request could use
+var ignoredHeaders = map[string]bool{
+	"age":               true,
+	"cache-control":     true,
+	"connection":        true,
+	"content-encoding":  true,
+	"content-length":    true,
+	"content-type":      true,
+	"date":              true,
+	"expires":           true,
+	"keep-alive":        true,
+	"last-modified":     true,
+	"server":            true,
+	"transfer-encoding": true,
+	"vary":              true,
+}
+
+// Form fields and meta tags in HTML, e.g. a CSRF token
+var (
+	htmlTag       = regexp.MustCompile(`(?i)<(?:input|meta)\b[^>]*>`)
+	htmlName      = regexp.MustCompile(`(?i)\bname\s*=\s*"([^"]+)"`)
+	htmlValue     = regexp.MustCompile(`(?i)\b(value|content)\s*=\s*"([^"]*)"`)
+	plainJSONName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+)
+
+// candidate is a value found in a response and how to find it again
+type candidate struct {
+	value     string
+	source    string
+	name      string
+	transform *transforms.ResponseCaptureTransform
+}
+
+// location is a string in a request and where it is
+type location struct {
+	name string
+	text string
+}
+
+// Analyze finds every value that first appears in a response and reappears
+// in a later request. The suggested transforms are for the given archive and
+// in the order they should be applied.
+func Analyze(har *model.Har, archiveID int64) ([]Suggestion, error) {
+	requests := make([][]location, len(har.Entries))
+	for i, entry := range har.Entries {
+		requests[i] = requestLocations(entry.Request)
+	}
+
+	suggestions := []*Suggestion{}
+	byTransform := map[string]*Suggestion{}
+	seen := map[string]bool{}
+	correlated := map[string]bool{}
+	for i, entry := range har.Entries {
+		if entry.Response == nil {
+			continue
+		}
+		for _, found := range candidates(urlPatternFor(entry.Request, correlated), entry.Response) {
+			if seen[found.value] {
+				continue
+			}
+			seen[found.value] = true
+			if sentBefore(requests[:i+1], found.value) {
+				// It didn't come from this response
+				continue
+			}
+			uses := usesOf(requests, i+1, found.value)
+			if len(uses) == 0 {
+				continue
+			}
+
+			correlated[found.value] = true
+			if entry.Request != nil {
+				// Other methods on the same URL won't answer with the value
+				found.transform.Method = entry.Request.Method
+			}
+
+			record, err := persistence.MakeTransformFor(archiveID, found.transform)
+			if err != nil {
+				return nil, err
+			}
+			if existing, ok := byTransform[record.MarshaledJSON]; ok {
+				existing.Values = append(existing.Values, found.value)
+				existing.Uses = append(existing.Uses, uses...)
+				continue
+			}
+			suggestion := &Suggestion{
+				Source:     found.source,
+				Name:       found.name,
+				EntryIndex: i,
+				URL:        requestURL(entry.Request),
+				Values:     []string{found.value},
+				Uses:       uses,
+				Transform:  *record,
+			}
+			byTransform[record.MarshaledJSON] = suggestion
+			suggestions = append(suggestions, suggestion)
+		}
+	}
+
+	result := make([]Suggestion, len(suggestions))
+	for i, suggestion := range suggestions {
+		suggestion.Transform.Position = i
+		result[i] = *suggestion
+	}
+	return result, nil
+}
+
+// candidates are the values in a response that could be sent back later,
+// with transforms that read responses to requests matching the urlPattern
+func candidates(urlPattern string, response *model.Response) []candidate {
+	found := []candidate{}
+
+	for _, header := range response.Headers {
+		if header.Key == nil || header.Value == nil {
+			continue
+		}
+		name := *header.Key
+		if strings.EqualFold(name, "Set-Cookie") {
+			parts := strings.SplitN(strings.SplitN(*header.Value, ";", 2)[0], "=", 2)
+			if len(parts) != 2 {
+				continue
+			}
+			cookie, value := strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+			found = append(found, candidate{
+				value:  value,
+				source: "cookie",
+				name:   cookie,
+				transform: &transforms.ResponseCaptureTransform{
+					URLPattern: urlPattern,
+					Header:     "Set-Cookie",
+					Pattern:    `^\s*` + regexp.QuoteMeta(cookie) + `=([^;]*)`,
+				},
+			})
+			continue
+		}
+		if ignoredHeaders[strings.ToLower(name)] {
+			continue
+		}
+		found = append(found, candidate{
+			value:     *header.Value,
+			source:    "header",
+			name:      name,
+			transform: &transforms.ResponseCaptureTransform{URLPattern: urlPattern, Header: name},
+		})
+	}
+
+	body := response.Body()
+	if document, err := transforms.DecodeJSON(body); err == nil && strings.TrimSpace(body) != "" {
+		eachJSONValue(document, "$", func(path, value string) {
+			found = append(found, candidate{
+				value:     value,
+				source:    "body",
+				name:      path,
+				transform: &transforms.ResponseCaptureTransform{URLPattern: urlPattern, Path: path},
+			})
+		})
+	} else {
+		for _, tag := range htmlTag.FindAllString(body, -1) {
+			name, value := htmlName.FindStringSubmatchIndex(tag), htmlValue.FindStringSubmatchIndex(tag)
+			if name == nil || value == nil {
+				continue
+			}
+			fieldName := tag[name[2]:name[3]]
+			attribute := tag[value[2]:value[3]]
+			pattern := `name="` + regexp.QuoteMeta(fieldName) + `"[^>]*` + attribute + `="([^"]*)"`
+			if value[0] < name[0] {
+				pattern = attribute + `="([^"]*)"[^>]*name="` + regexp.QuoteMeta(fieldName) + `"`
+			}
+			found = append(found, candidate{
+				value:     tag[value[4]:value[5]],
+				source:    "body",
+				name:      fieldName,
+				transform: &transforms.ResponseCaptureTransform{URLPattern: urlPattern, Pattern: pattern},
+			})
+		}
+	}
+
+	interesting := found[:0]
+	for _, each := range found {
+		if isInteresting(each.value) {
+			interesting = append(interesting, each)
+		}
+	}
+	return interesting
+}
+
+// eachJSONValue calls fn with the path to, and value of, every string and
+// number in a decoded JSON document
+func eachJSONValue(node interface{}, path string, fn func(path, value string)) {
+	switch n := node.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(n))
+		for key := range n {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			child := path + "['" + key + "']"
+			if plainJSONName.MatchString(key) {
+				child = path + "." + key
+			}
+			eachJSONValue(n[key], child, fn)
+		}
+	case []interface{}:
+		for i, value := range n {
+			eachJSONValue(value, path+"["+strconv.Itoa(i)+"]", fn)
+		}
+	case string, json.Number:
+		fn(path, transforms.JSONValueString(n))
+	}
+}
+
+// isInteresting says whether a value looks like a token or an ID rather than
+// a word, a flag or a link that could turn up anywhere
+func isInteresting(value string) bool {
+	if len(value) < 4 || len(value) > 4096 {
+		return false
+	}
+	if strings.ContainsAny(value, " \t\r\n") || strings.Contains(value, "://") || strings.HasPrefix(value, "/") {
+		return false
+	}
+	return strings.ContainsAny(value, "0123456789") || len(value) >= 16
+}
+
+// requestLocations are the strings in a request that a value could be in
+func requestLocations(request *model.Request) []location {
+	if request == nil {
+		return nil
+	}
+	locations := []location{{name: "url", text: request.URL}}
+	pairs := func(kind string, items []model.SingleItemMap) {
+		for _, pair := range items {
+			if pair.Key == nil || pair.Value == nil || strings.EqualFold(*pair.Key, "Content-Length") {
+				continue
+			}
+			locations = append(locations, location{name: kind + " " + *pair.Key, text: *pair.Value})
+		}
+	}
+	pairs("header", request.Headers)
+	for _, cookie := range request.Cookies {
+		pairs("cookie", []model.SingleItemMap{cookie.SingleItemMap})
+	}
+	if request.PostData != nil {
+		locations = append(locations, location{name: "body", text: request.PostData.Text})
+		pairs("param", request.PostData.Params)
+	}
+	return locations
+}
+
+// sentBefore says whether any of the requests already had the value
+func sentBefore(requests [][]location, value string) bool {
+	for _, locations := range requests {
+		for _, each := range locations {
+			if containsValue(each.text, value) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// usesOf is everywhere the value is sent from the given entry on
+func usesOf(requests [][]location, from int, value string) []Use {
+	uses := []Use{}
+	for i := from; i < len(requests); i++ {
+		used := map[string]bool{}
+		for _, each := range requests[i] {
+			if !used[each.name] && containsValue(each.text, value) {
+				used[each.name] = true
+				uses = append(uses, Use{EntryIndex: i, Location: each.name})
+			}
+		}
+	}
+	return uses
+}
+
+// containsValue looks for the value, as it is or escaped for a URL, where it
+// isn't just part of a longer word or number. That's how the transform will
+// replace it too.
+func containsValue(text, value string) bool {
+	if transforms.ContainsWhole(text, value) {
+		return true
+	}
+	escaped := url.QueryEscape(value)
+	return escaped != value && transforms.ContainsWhole(text, escaped)
+}
+
+// urlPatternFor matches requests to the same path on any host, so that the
+// suggestion still works when replaying against another one. Parts of the
+// path that are themselves correlated values match anything since they'll
+// have been replaced by the time the request is sent.
+func urlPatternFor(request *model.Request, correlated map[string]bool) string {
+	u, err := url.Parse(requestURL(request))
+	if err != nil || u.Path == "" {
+		return ""
+	}
+	segments := strings.Split(u.EscapedPath(), "/")
+	for i, segment := range segments {
+		if unescaped, err := url.PathUnescape(segment); err == nil && correlated[unescaped] {
+			segments[i] = `[^/]+`
+		} else {
+			segments[i] = regexp.QuoteMeta(segment)
+		}
+	}
+	return `://[^/]+` + strings.Join(segments, "/") + `(\?|$)`
+}
+
+func requestURL(request *model.Request) string {
+	if request == nil {
+		return ""
+	}
+	return request.URL
+}
@@ -0,0 +1,160 @@
+package correlation
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/JackDanger/traffic/model"
+	"github.com/JackDanger/traffic/transforms"
+	"github.com/JackDanger/traffic/util"
+)
+
+func pairs(keysAndValues ...string) []model.SingleItemMap {
+	items := []model.SingleItemMap{}
+	for i := 0; i < len(keysAndValues); i += 2 {
+		items = append(items, model.SingleItemMap{Key: util.StringPtr(keysAndValues[i]), Value: util.StringPtr(keysAndValues[i+1])})
+	}
+	return items
+}
+
+func entry(method, url string, headers []model.SingleItemMap, body string, responseHeaders []model.SingleItemMap, responseBody string) model.Entry {
+	request := &model.Request{Method: method, URL: url, Headers: headers}
+	if body != "" {
+		request.PostData = &model.PostData{MimeType: "application/json", Text: body}
+	}
+	response := &model.Response{Status: 200, Headers: responseHeaders}
+	response.Content.Text = responseBody
+	return model.Entry{Request: request, Response: response}
+}
+
+func testHar() *model.Har {
+	return &model.Har{Entries: []model.Entry{
+		entry("POST", "https://example.com/login?client=7781", nil, `{"user": "alice"}`,
+			pairs("Set-Cookie", "sid=s3ss10n4242; Path=/", "Date", "Mon, 02 Jan 2006 15:04:05 GMT"),
+			`{"token": "abc123XYZ", "client": "7781", "user": {"id": 4242, "admin": false, "name": "alice"}}`),
+		entry("GET", "https://example.com/users/4242", pairs("Authorization", "Bearer abc123XYZ"), "",
+			pairs("Content-Type", "text/html"),
+			`<form><input type="hidden" name="csrf" value="f00dcafe99"></form>`),
+		entry("POST", "https://example.com/users/4242/posts", pairs("Authorization", "Bearer abc123XYZ", "X-Session", "s3ss10n4242"), `{"csrf": "f00dcafe99", "post": 42420}`,
+			nil, `{}`),
+		// The same URL with another method doesn't hand out a token
+		entry("GET", "https://example.com/login", nil, "", nil, `{"user": null}`),
+	}}
+}
+
+func TestAnalyze(t *testing.T) {
+	suggestions, err := Analyze(testHar(), 12)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	found := map[string]Suggestion{}
+	for _, suggestion := range suggestions {
+		found[suggestion.Source+" "+suggestion.Name] = suggestion
+	}
+	if len(suggestions) != 4 {
+		t.Errorf("Expected 4 suggestions, got: %#v", found)
+	}
+
+	token := found["body $.token"]
+	if token.EntryIndex != 0 || len(token.Uses) != 2 || token.Uses[0] != (Use{EntryIndex: 1, Location: "header Authorization"}) {
+		t.Errorf("Expected the token to be used in both later requests, got: %#v", token)
+	}
+	if !strings.Contains(token.Transform.MarshaledJSON, `"method": "POST"`) {
+		t.Errorf("Expected the token to be captured from POSTs only, got: %s", token.Transform.MarshaledJSON)
+	}
+	if userID := found["body $.user.id"]; len(userID.Uses) != 2 || userID.Uses[0].Location != "url" {
+		t.Errorf("Expected the user's ID to be used in later URLs and not to match 42420, got: %#v", userID)
+	}
+	if cookie := found["cookie sid"]; len(cookie.Uses) != 1 || cookie.Uses[0].Location != "header X-Session" {
+		t.Errorf("Expected the cookie to be found, got: %#v", cookie)
+	}
+	if csrf := found["body csrf"]; csrf.EntryIndex != 1 || len(csrf.Uses) != 1 || csrf.Uses[0].Location != "body" {
+		t.Errorf("Expected the CSRF token to be found in the HTML, got: %#v", csrf)
+	}
+	if _, ok := found["body $.client"]; ok {
+		t.Error("Expected a value that was sent before the response not to be suggested")
+	}
+
+	for i, suggestion := range suggestions {
+		if suggestion.Transform.ArchiveID != 12 || suggestion.Transform.Position != i || suggestion.Transform.Type != "ResponseCaptureTransform" {
+			t.Errorf("Expected a transform for the archive in order, got: %#v", suggestion.Transform)
+		}
+		if err := suggestion.Transform.Validate(); err != nil {
+			t.Errorf("Expected a valid transform, got: %s", err)
+		}
+	}
+}
+
+func TestSuggestedTransformsReplaceRecordedValues(t *testing.T) {
+	har := testHar()
+	suggestions, err := Analyze(har, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	requestTransforms := []transforms.RequestTransform{}
+	for _, suggestion := range suggestions {
+		transform, err := suggestion.Transform.Model()
+		if err != nil {
+			t.Fatal(err)
+		}
+		requestTransforms = append(requestTransforms, transform)
+	}
+	session := transforms.NewSession()
+	transforms.UseSession(session, requestTransforms)
+
+	// Play the HAR against a server that hands out different values
+	live := []string{
+		"abc123XYZ", "LIVE-token-1",
+		"s3ss10n4242", "live-session-1",
+		"f00dcafe99", "live-csrf-1",
+		"4242", "9999",
+	}
+	replaceLive := func(text string) string {
+		for i := 0; i < len(live); i += 2 {
+			text = strings.Replace(text, live[i], live[i+1], -1)
+		}
+		return text
+	}
+	sent := []*model.Request{}
+	for _, entry := range har.Entries {
+		request := entry.Request.Copy()
+		responseTransforms := []transforms.ResponseTransform{}
+		for _, transform := range requestTransforms {
+			responseTransforms = append(responseTransforms, transform.T(&request))
+		}
+		sent = append(sent, &request)
+
+		response := &model.Response{Headers: []model.SingleItemMap{}}
+		for _, header := range entry.Response.Headers {
+			value := replaceLive(*header.Value)
+			response.Headers = append(response.Headers, model.SingleItemMap{Key: header.Key, Value: &value})
+		}
+		body := replaceLive(entry.Response.Body())
+		response.ContentBody = &body
+
+		for i, responseTransform := range responseTransforms {
+			if recorded, ok := responseTransform.(transforms.RecordedResponseTransform); ok {
+				recorded.Recorded(entry.Response)
+			}
+			requestTransforms[i] = responseTransform.T(response)
+		}
+	}
+
+	if errs := session.Errors(); len(errs) != 0 {
+		t.Errorf("Expected no errors, got: %v", errs)
+	}
+	last := sent[2]
+	if last.URL != "https://example.com/users/9999/posts" {
+		t.Errorf("Expected the live user ID in the URL, got: %s", last.URL)
+	}
+	expected := pairs("Authorization", "Bearer LIVE-token-1", "X-Session", "live-session-1")
+	for i, header := range last.Headers {
+		if *header.Value != *expected[i].Value {
+			t.Errorf("Expected %s to be %s, got: %s", *header.Key, *expected[i].Value, *header.Value)
+		}
+	}
+	if last.PostData.Text != `{"csrf": "live-csrf-1", "post": 42420}` {
+		t.Errorf("Expected the live CSRF token in the body, got: %s", last.PostData.Text)
+	}
+}
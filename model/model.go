@@ -4,7 +4,9 @@
 package model
 
 import (
+	"encoding/base64"
 	"encoding/json"
+	"time"
 )
 
 // HarWrapper exists because the HAR file contains a top-level key
@@ -48,6 +50,28 @@ type Request struct {
 	PostData    *PostData       `json:"postData,omitempty"`
 }
 
+// Copy returns a deep copy of the request so that it can be transformed
+// without touching the recorded one, which other sessions may be replaying at
+// the same time.
+func (r Request) Copy() Request {
+	r.Headers = copyPairs(r.Headers)
+	r.QueryString = copyPairs(r.QueryString)
+	if r.Cookies != nil {
+		cookies := make([]Cookie, len(r.Cookies))
+		for i, cookie := range r.Cookies {
+			cookie.SingleItemMap = copyPair(cookie.SingleItemMap)
+			cookies[i] = cookie
+		}
+		r.Cookies = cookies
+	}
+	if r.PostData != nil {
+		postData := *r.PostData
+		postData.Params = copyPairs(postData.Params)
+		r.PostData = &postData
+	}
+	return r
+}
+
 // Response represents a single HTTP response
 type Response struct {
 	Status       int             `json:"status"`
@@ -61,6 +85,35 @@ type Response struct {
 	HeadersSize  int             `json:"headersSize"`
 	BodySize     int             `json:"bodySize"`
 	TransferSize *int            `json:"_transferSize,omitempty"`
+	Trace        *Trace          `json:"-"` // Trace is not present in HAR files
+}
+
+// Body is the response's body: what was received for a live response or
+// what was recorded in the HAR, if anything
+func (r *Response) Body() string {
+	if r.ContentBody != nil {
+		return *r.ContentBody
+	}
+	if r.Content.Encoding == "base64" {
+		decoded, err := base64.StdEncoding.DecodeString(r.Content.Text)
+		if err == nil {
+			return string(decoded)
+		}
+	}
+	return r.Content.Text
+}
+
+// Trace records how a live response was received: how long each phase of the
+// round trip took and how many bytes went over the wire. It's only present on
+// responses we've received ourselves, never on the recorded ones.
+type Trace struct {
+	DNS      time.Duration // looking up the host
+	Connect  time.Duration // establishing the TCP connection
+	TLS      time.Duration // the TLS handshake
+	TTFB     time.Duration // from sending the request to the first response byte
+	Total    time.Duration // from sending the request to reading the whole body
+	BytesIn  int64         // the response body as transferred (maybe compressed)
+	BytesOut int64         // the request body
 }
 
 // SingleItemMap is a single key-value pair because that's how HAR
@@ -71,6 +124,30 @@ type SingleItemMap struct {
 	Value *string `json:"value"`
 }
 
+func copyPairs(pairs []SingleItemMap) []SingleItemMap {
+	if pairs == nil {
+		return nil
+	}
+	copied := make([]SingleItemMap, len(pairs))
+	for i, pair := range pairs {
+		copied[i] = copyPair(pair)
+	}
+	return copied
+}
+
+func copyPair(pair SingleItemMap) SingleItemMap {
+	copied := SingleItemMap{}
+	if pair.Key != nil {
+		key := *pair.Key
+		copied.Key = &key
+	}
+	if pair.Value != nil {
+		value := *pair.Value
+		copied.Value = &value
+	}
+	return copied
+}
+
 // PostData represents the content type and then two ways to look at the
 // data that's submitted with a POST request
 type PostData struct {
@@ -108,6 +185,8 @@ type content struct {
 	Size        int    `json:"size"`
 	MimeType    string `json:"mimeType"`
 	Compression int    `json:"compression,omitempty"`
+	Text        string `json:"text,omitempty"`     // the recorded body, if it was saved
+	Encoding    string `json:"encoding,omitempty"` // "base64" if the Text is encoded
 }
 
 type cache struct{}
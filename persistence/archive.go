@@ -7,6 +7,7 @@ import (
 
 	"github.com/JackDanger/traffic/model"
 	"github.com/JackDanger/traffic/parser"
+	"github.com/JackDanger/traffic/transforms"
 	"github.com/JackDanger/traffic/util"
 )
 
@@ -17,6 +18,7 @@ type Archive struct {
 	Name        string     `json:"name" db:"name"`
 	Source      string     `json:"source" db:"source"`
 	Description string     `json:"description" db:"description"`
+	Target      string     `json:"target" db:"target"` // e.g. "https://www.example.com=http://localhost:8000"
 	CreatedAt   *time.Time `json:"created_at" db:"created_at"`
 	UpdatedAt   *time.Time `json:"updated_at" db:"updated_at"`
 }
@@ -26,6 +28,15 @@ func (a *Archive) Model() (*model.Har, error) {
 	return parser.HarFrom(a.Source)
 }
 
+// TargetTransform points the archive's requests at its Target origins instead
+// of where they were recorded. It's nil when there's no Target.
+func (a *Archive) TargetTransform() (*transforms.TargetTransform, error) {
+	if a.Target == "" {
+		return nil, nil
+	}
+	return transforms.NewTargetTransform(a.Target)
+}
+
 // MakeArchive prepares a model.Har into an Archive that can be stored.
 func MakeArchive(name, description string, har *model.Har) (*Archive, error) {
 	json, err := parser.HarToJSON(har)
@@ -52,7 +63,7 @@ func (a Archive) FromJSON(b []byte) (*Archive, error) {
 func (a Archive) Get(db *DB, id int64) (*Archive, error) {
 	archive := &Archive{}
 	archive.ID = id
-	err := db.Get(archive, db.Archives.C("id"))
+	err := db.Get(archive)
 	return archive, err
 }
 
@@ -76,20 +87,15 @@ func (a *Archive) Create(db *DB) error {
 
 // GetArchive finds just one har record by id from the database
 func (db *DB) GetArchive(id int) (*Archive, error) {
-	var records []Archive
-	err := db.Select(&records, db.Archives.Select("*").Where(db.Archives.C("id").Eq(id)))
-	if len(records) > 0 {
-		return &records[0], err
+	archive := &Archive{ID: int64(id)}
+	err := db.Get(archive)
+	if err == ErrNotFound {
+		return nil, nil
 	}
-	return nil, err
-}
-
-// ListArchives returns all of the har records from the database as model
-// instances
-func (db *DB) ListArchives() ([]Archive, error) {
-	var records []Archive
-	err := db.Select(&records, db.Archives.Select("*"))
-	return records, err
+	if err != nil {
+		return nil, err
+	}
+	return archive, nil
 }
 
 // AsJSON represents the archive as a whole in JSON. The source string
@@ -99,16 +105,3 @@ func (a *Archive) AsJSON() []byte {
 	j, _ := json.MarshalIndent(a, "", "  ")
 	return j
 }
-
-// Schema is used to generate the table initially
-func (a Archive) Schema() string {
-	return `
-    CREATE TABLE IF NOT EXISTS archives (
-      id INT NOT NULL AUTO_INCREMENT PRIMARY KEY,
-      name VARCHAR(255),
-      description text NOT NULL, -- Let everybody know how to use this
-      source LONGTEXT NOT NULL, -- the JSON contents of the HAR
-      created_at DATETIME NOT NULL,
-      updated_at DATETIME NOT NULL
-    );`
-}
@@ -89,3 +89,20 @@ func TestListArchives(t *testing.T) {
 		t.Errorf("Unexpected CreatedAt retrieved: %s, expected: %s", retrieved.CreatedAt, archive.CreatedAt)
 	}
 }
+
+func TestArchiveTargetTransform(t *testing.T) {
+	archive := &Archive{}
+	transform, err := archive.TargetTransform()
+	if err != nil || transform != nil {
+		t.Errorf("Expected no transform without a target, got: %#v, %s", transform, err)
+	}
+
+	archive.Target = "https://api.github.com=http://localhost:8000"
+	transform, err = archive.TargetTransform()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if transform.Targets["https://api.github.com"] != "http://localhost:8000" {
+		t.Errorf("Unexpected targets: %#v", transform.Targets)
+	}
+}
@@ -0,0 +1,428 @@
+package persistence
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// FileStore keeps every table as a file of JSON lines in a single directory.
+// It's the default so that traffic works without a database server; it's
+// fine for the handful of archives and runs a single person creates but
+// anything shared should use MySQLStore.
+//
+// Each insert, update and delete appends a line to the table's file rather
+// than rewriting it, and a table is rewritten with just its current records
+// once most of its lines are out of date. Before every operation the store
+// reads whatever lines were appended since it last looked, so commands
+// pointed at the same directory see each other's records. Nothing stops two
+// processes writing at once though, and if they do they can hand out the
+// same ID, so only one process should change records at a time.
+type FileStore struct {
+	Dir string
+
+	m      sync.Mutex
+	tables map[string]*fileTable
+}
+
+var _ Store = &FileStore{}
+
+// fileTable is what's been read of one table's file
+type fileTable struct {
+	nextID  int64
+	records []fileRecord // in order of ID
+	file    os.FileInfo  // the file that was read, to notice when it's rewritten
+	read    int64        // how many bytes of it have been read
+	lines   int
+}
+
+type fileRecord struct {
+	id  int64
+	raw json.RawMessage
+}
+
+// fileLine is one line of a table's file: a record as it is now, or a note
+// that it was deleted
+type fileLine struct {
+	ID      int64           `json:"id"`
+	Record  json.RawMessage `json:"record,omitempty"`
+	Deleted bool            `json:"deleted,omitempty"`
+}
+
+// NewFileStore keeps records in the given directory, creating it if necessary
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &FileStore{Dir: dir, tables: map[string]*fileTable{}}, nil
+}
+
+// tableFor is the name of the table a record belongs in
+func tableFor(record Model) string {
+	switch record.(type) {
+	case *Archive:
+		return "archives"
+	case *Transform:
+		return "transforms"
+	case *Run:
+		return "runs"
+	case *RunResult:
+		return "run_results"
+	}
+	panic(fmt.Sprintf("unknown record type: %T", record))
+}
+
+func (s *FileStore) path(table string) string {
+	return filepath.Join(s.Dir, table+".jsonl")
+}
+
+// load catches up on the lines appended to a table's file since it was last
+// read. A table that's never been written is empty.
+func (s *FileStore) load(table string) (*fileTable, error) {
+	t, ok := s.tables[table]
+	if !ok {
+		t = &fileTable{}
+		s.tables[table] = t
+	}
+	f, err := os.Open(s.path(table))
+	if os.IsNotExist(err) {
+		*t = fileTable{}
+		return t, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if t.file != nil && !os.SameFile(t.file, info) {
+		// It's been rewritten, start over
+		*t = fileTable{}
+	}
+	t.file = info
+	if _, err := f.Seek(t.read, io.SeekStart); err != nil {
+		return nil, err
+	}
+	b, err := ioutil.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+	// A line that's still being written is left for next time
+	complete := bytes.LastIndexByte(b, '\n') + 1
+	for _, text := range bytes.Split(b[:complete], []byte("\n")) {
+		if len(bytes.TrimSpace(text)) == 0 {
+			continue
+		}
+		line := fileLine{}
+		if err := json.Unmarshal(text, &line); err != nil {
+			return nil, fmt.Errorf("reading %s: %s", s.path(table), err)
+		}
+		t.apply(line)
+	}
+	t.read += int64(complete)
+	return t, nil
+}
+
+// write appends lines to the table's file. The caller has just loaded it.
+func (s *FileStore) write(table string, t *fileTable, lines ...fileLine) error {
+	b := []byte{}
+	for _, line := range lines {
+		encoded, err := json.Marshal(line)
+		if err != nil {
+			return err
+		}
+		b = append(append(b, encoded...), '\n')
+	}
+	f, err := os.OpenFile(s.path(table), os.O_WRONLY|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	// Anything after what load read is a line a crash left half written.
+	// Writing after it would join the two into one line nobody can read.
+	if err := f.Truncate(t.read); err != nil {
+		f.Close()
+		return err
+	}
+	if _, err := f.WriteAt(b, t.read); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	for _, line := range lines {
+		t.apply(line)
+	}
+	t.read += int64(len(b))
+
+	if t.lines > compactAfter && t.lines > 2*len(t.records) {
+		return s.compact(table, t)
+	}
+	return nil
+}
+
+// compactAfter is how many lines a table's file can have before it's worth
+// rewriting it without the ones that are out of date
+const compactAfter = 100
+
+// compact rewrites a table's file with just its current records. It writes
+// to a temporary file first so that a crash halfway through can't leave a
+// table half written.
+func (s *FileStore) compact(table string, t *fileTable) error {
+	lines := []fileLine{}
+	for _, record := range t.records {
+		lines = append(lines, fileLine{ID: record.id, Record: record.raw})
+	}
+	if len(t.records) == 0 || t.records[len(t.records)-1].id < t.nextID {
+		// Remember the last ID handed out so it isn't handed out again
+		lines = append(lines, fileLine{ID: t.nextID, Deleted: true})
+	}
+	buf := bytes.Buffer{}
+	for _, line := range lines {
+		b, err := json.Marshal(line)
+		if err != nil {
+			return err
+		}
+		buf.Write(b)
+		buf.WriteByte('\n')
+	}
+
+	tmp, err := ioutil.TempFile(s.Dir, table+".jsonl.")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(buf.Bytes()); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), s.path(table)); err != nil {
+		return err
+	}
+	info, err := os.Stat(s.path(table))
+	if err != nil {
+		return err
+	}
+	t.file, t.read, t.lines = info, int64(buf.Len()), len(lines)
+	return nil
+}
+
+// apply adds, replaces or removes the line's record
+func (t *fileTable) apply(line fileLine) {
+	t.lines++
+	if line.ID > t.nextID {
+		t.nextID = line.ID
+	}
+	i := sort.Search(len(t.records), func(i int) bool { return t.records[i].id >= line.ID })
+	exists := i < len(t.records) && t.records[i].id == line.ID
+	switch {
+	case line.Deleted && exists:
+		t.records = append(t.records[:i], t.records[i+1:]...)
+	case line.Deleted:
+	case exists:
+		t.records[i].raw = line.Record
+	default:
+		t.records = append(t.records, fileRecord{})
+		copy(t.records[i+1:], t.records[i:])
+		t.records[i] = fileRecord{id: line.ID, raw: line.Record}
+	}
+}
+
+// find is the position of the record with the given ID, or -1
+func (t *fileTable) find(id int64) int {
+	i := sort.Search(len(t.records), func(i int) bool { return t.records[i].id >= id })
+	if i < len(t.records) && t.records[i].id == id {
+		return i
+	}
+	return -1
+}
+
+// Insert persists new records and assigns their IDs. The records for each
+// table are appended to its file all at once.
+func (s *FileStore) Insert(records ...Model) error {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	tables := []string{}
+	pending := map[string][]fileLine{}
+	for _, record := range records {
+		table := tableFor(record)
+		if _, ok := pending[table]; !ok {
+			if _, err := s.load(table); err != nil {
+				return err
+			}
+			tables = append(tables, table)
+			pending[table] = []fileLine{}
+		}
+		id := s.tables[table].nextID + int64(len(pending[table])) + 1
+		setRecordID(record, id)
+		raw, err := json.Marshal(record)
+		if err != nil {
+			return err
+		}
+		pending[table] = append(pending[table], fileLine{ID: id, Record: raw})
+	}
+	for _, table := range tables {
+		if err := s.write(table, s.tables[table], pending[table]...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Update overwrites the stored record that has the same ID
+func (s *FileStore) Update(record Model) (int64, error) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	table := tableFor(record)
+	t, err := s.load(table)
+	if err != nil {
+		return 0, err
+	}
+	id := recordID(record)
+	if t.find(id) < 0 {
+		return 0, nil
+	}
+	raw, err := json.Marshal(record)
+	if err != nil {
+		return 0, err
+	}
+	return 1, s.write(table, t, fileLine{ID: id, Record: raw})
+}
+
+// Delete removes the stored record that has the same ID
+func (s *FileStore) Delete(record Model) (int64, error) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	table := tableFor(record)
+	t, err := s.load(table)
+	if err != nil {
+		return 0, err
+	}
+	id := recordID(record)
+	if t.find(id) < 0 {
+		return 0, nil
+	}
+	return 1, s.write(table, t, fileLine{ID: id, Deleted: true})
+}
+
+// Get fills in the record with the stored one that has the same ID
+func (s *FileStore) Get(record Model) error {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	t, err := s.load(tableFor(record))
+	if err != nil {
+		return err
+	}
+	i := t.find(recordID(record))
+	if i < 0 {
+		return ErrNotFound
+	}
+	return json.Unmarshal(t.records[i].raw, record)
+}
+
+// list decodes every record of a table into a pointer to a slice
+func (s *FileStore) list(table string, records interface{}) error {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	t, err := s.load(table)
+	if err != nil {
+		return err
+	}
+	raws := []json.RawMessage{}
+	for _, record := range t.records {
+		raws = append(raws, record.raw)
+	}
+	b, err := json.Marshal(raws)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, records)
+}
+
+// ListArchives returns all of the har records from the database as model
+// instances
+func (s *FileStore) ListArchives() ([]Archive, error) {
+	var records []Archive
+	err := s.list("archives", &records)
+	return records, err
+}
+
+// ListTransformsFor returns all of the transform records (instantiated as
+// appropriate Transform objects) for a given Archive id in the order they're
+// to be applied.
+func (s *FileStore) ListTransformsFor(archiveID int64) ([]Transform, error) {
+	var all, records []Transform
+	if err := s.list("transforms", &all); err != nil {
+		return nil, err
+	}
+	for _, record := range all {
+		if record.ArchiveID == archiveID {
+			records = append(records, record)
+		}
+	}
+	// They're already in order of id
+	sort.SliceStable(records, func(i, j int) bool { return records[i].Position < records[j].Position })
+	return records, nil
+}
+
+// ListRuns returns every run, newest first. Pass an archive id to see only
+// the runs of that archive or 0 to see all of them.
+func (s *FileStore) ListRuns(archiveID int64) ([]Run, error) {
+	var all, records []Run
+	if err := s.list("runs", &all); err != nil {
+		return nil, err
+	}
+	for _, record := range all {
+		if archiveID == 0 || record.ArchiveID == archiveID {
+			records = append(records, record)
+		}
+	}
+	sort.Slice(records, func(i, j int) bool { return records[i].ID > records[j].ID })
+	return records, nil
+}
+
+// ListRunResultsFor returns the sampled results of a Run in the order they
+// were recorded
+func (s *FileStore) ListRunResultsFor(runID int64) ([]RunResult, error) {
+	var all, records []RunResult
+	if err := s.list("run_results", &all); err != nil {
+		return nil, err
+	}
+	for _, record := range all {
+		if record.RunID == runID {
+			records = append(records, record)
+		}
+	}
+	return records, nil
+}
+
+// Truncate removes every table's file
+func (s *FileStore) Truncate() {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	for _, table := range []string{"archives", "transforms", "runs", "run_results"} {
+		err := os.Remove(s.path(table))
+		if err != nil && !os.IsNotExist(err) {
+			panic(err)
+		}
+	}
+	s.tables = map[string]*fileTable{}
+}
@@ -0,0 +1,196 @@
+package persistence
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestFileStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "traffic")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	store, err := Open("file://" + dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first := &Archive{Name: "first"}
+	second := &Archive{Name: "second"}
+	for _, archive := range []*Archive{first, second} {
+		if err := archive.Create(store); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if first.ID != 1 || second.ID != 2 {
+		t.Errorf("Expected ids to be assigned in order, got: %d, %d", first.ID, second.ID)
+	}
+
+	second.Description = "changed"
+	if changed, err := store.Update(second); err != nil || changed != 1 {
+		t.Errorf("Expected to update one record, got: %d (%v)", changed, err)
+	}
+
+	// A second store reading the same directory sees the same records
+	other, err := Open("file://" + dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored, err := Archive{}.Get(other, second.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Name != "second" || stored.Description != "changed" {
+		t.Errorf("Expected the updated record, got: %#v", stored)
+	}
+
+	if deleted, err := other.Delete(first); err != nil || deleted != 1 {
+		t.Errorf("Expected to delete one record, got: %d (%v)", deleted, err)
+	}
+	if _, err := (Archive{}).Get(store, first.ID); err != ErrNotFound {
+		t.Errorf("Expected the deleted record to be gone, got: %v", err)
+	}
+	archives, err := store.ListArchives()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(archives) != 1 || archives[0].ID != second.ID {
+		t.Errorf("Expected only the second archive to be left, got: %#v", archives)
+	}
+
+	// Ids aren't reused after a delete
+	third := &Archive{Name: "third"}
+	if err := third.Create(store); err != nil {
+		t.Fatal(err)
+	}
+	if third.ID != 3 {
+		t.Errorf("Expected a new id, got: %d", third.ID)
+	}
+}
+
+func TestFileStoreAppendsAndCompacts(t *testing.T) {
+	dir, err := ioutil.TempDir("", "traffic")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	store, err := Open("file://" + dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader, err := Open("file://" + dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kept := &Archive{Name: "kept"}
+	if err := kept.Create(store); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := (Archive{}).Get(reader, kept.ID); err != nil {
+		t.Fatalf("Expected the other store to see the archive, got: %v", err)
+	}
+	last := &Archive{Name: "last"}
+	if err := last.Create(store); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3*compactAfter; i++ {
+		kept.Description = strconv.Itoa(i)
+		if _, err := store.Update(kept); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := store.Delete(last); err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := ioutil.ReadFile(filepath.Join(dir, "archives.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Count(string(content), "\n"); lines > compactAfter+1 {
+		t.Errorf("Expected out of date lines to be compacted away, got %d lines", lines)
+	}
+
+	stored, err := Archive{}.Get(reader, kept.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := strconv.Itoa(3*compactAfter - 1); stored.Description != expected {
+		t.Errorf("Expected the other store to see the latest update, %s, got: %s", expected, stored.Description)
+	}
+	if _, err := (Archive{}).Get(reader, last.ID); err != ErrNotFound {
+		t.Errorf("Expected the other store to see the delete, got: %v", err)
+	}
+
+	// A compacted table remembers the last ID it handed out
+	fresh, err := Open("file://" + dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	next := &Archive{Name: "next"}
+	if err := next.Create(fresh); err != nil {
+		t.Fatal(err)
+	}
+	if next.ID != last.ID+1 {
+		t.Errorf("Expected the deleted archive's ID not to be reused, got: %d", next.ID)
+	}
+}
+
+func TestFileStoreRecoversFromATornLine(t *testing.T) {
+	dir, err := ioutil.TempDir("", "traffic")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	store, err := Open("file://" + dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := &Archive{Name: "first"}
+	if err := first.Create(store); err != nil {
+		t.Fatal(err)
+	}
+
+	// A crash in the middle of writing the next record
+	f, err := os.OpenFile(filepath.Join(dir, "archives.jsonl"), os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"id": 2, "record": {"na`)
+	f.Close()
+
+	restarted, err := Open("file://" + dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second := &Archive{Name: "second"}
+	if err := second.Create(restarted); err != nil {
+		t.Fatal(err)
+	}
+
+	fresh, err := Open("file://" + dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	archives, err := fresh.ListArchives()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(archives) != 2 || archives[0].Name != "first" || archives[1].Name != "second" {
+		t.Errorf("Expected the half written line to be replaced by the next record, got: %#v", archives)
+	}
+}
+
+func TestOpenUnknownDSN(t *testing.T) {
+	if _, err := Open("postgres://localhost/traffic"); err == nil {
+		t.Errorf("Expected an error for a database we don't support")
+	}
+}
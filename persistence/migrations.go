@@ -0,0 +1,172 @@
+package persistence
+
+import "fmt"
+
+// Migration is one numbered change to the MySQL schema. Up makes the change
+// and Down undoes it so that a deploy can be rolled back. Each is a single
+// statement because the driver won't run more than one per query.
+//
+// Migrations are only ever appended to: once one has shipped changing it
+// won't change any database that's already applied it.
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Migrations is the whole history of the schema, oldest first. The version of
+// each is its position in the list, starting from 1.
+var Migrations = []Migration{
+	{
+		Version: 1,
+		Name:    "create_archives",
+		Up: `
+    CREATE TABLE IF NOT EXISTS archives (
+      id INT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+      name VARCHAR(255),
+      description text NOT NULL, -- Let everybody know how to use this
+      source LONGTEXT NOT NULL, -- the JSON contents of the HAR
+      created_at DATETIME NOT NULL,
+      updated_at DATETIME NOT NULL
+    );`,
+		Down: `DROP TABLE archives`,
+	},
+	{
+		Version: 2,
+		Name:    "create_transforms",
+		Up: `
+    CREATE TABLE IF NOT EXISTS transforms (
+      id INT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+      archive_id INT NOT NULL,
+      type VARCHAR(255) NOT NULL, -- the name of a Go struct
+      marshaled_json TEXT NOT NULL, -- the Go struct marshaled
+      created_at DATETIME NOT NULL,
+      updated_at DATETIME NOT NULL
+    );`,
+		Down: `DROP TABLE transforms`,
+	},
+	{
+		Version: 3,
+		Name:    "add_target_to_archives",
+		// where to replay the archive instead of its recorded origins
+		Up:   `ALTER TABLE archives ADD COLUMN target VARCHAR(1024) NOT NULL DEFAULT '' AFTER description`,
+		Down: `ALTER TABLE archives DROP COLUMN target`,
+	},
+	{
+		Version: 4,
+		Name:    "create_runs",
+		Up: `
+    CREATE TABLE IF NOT EXISTS runs (
+      id INT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+      run_id VARCHAR(64) NOT NULL, -- the id the server handed out when the run started
+      archive_id INT NOT NULL,
+      started_by VARCHAR(255) NOT NULL,
+      concurrency INT NOT NULL,
+      iterations INT NOT NULL,
+      velocity DOUBLE NOT NULL,
+      state VARCHAR(32) NOT NULL,
+      requests INT NOT NULL DEFAULT 0,
+      errors INT NOT NULL DEFAULT 0,
+      p50 BIGINT NOT NULL DEFAULT 0, -- nanoseconds
+      p90 BIGINT NOT NULL DEFAULT 0,
+      p99 BIGINT NOT NULL DEFAULT 0,
+      throughput DOUBLE NOT NULL DEFAULT 0,
+      summary TEXT NOT NULL, -- the JSON of a runner.Summary
+      started_at DATETIME NOT NULL,
+      ended_at DATETIME,
+      created_at DATETIME NOT NULL,
+      updated_at DATETIME NOT NULL,
+      INDEX (archive_id)
+    );`,
+		Down: `DROP TABLE runs`,
+	},
+	{
+		Version: 5,
+		Name:    "create_run_results",
+		Up: `
+    CREATE TABLE IF NOT EXISTS run_results (
+      id INT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+      run_id INT NOT NULL,
+      entry_index INT NOT NULL,
+      method VARCHAR(16) NOT NULL,
+      url TEXT NOT NULL,
+      status INT NOT NULL,
+      ttfb BIGINT NOT NULL, -- nanoseconds
+      total BIGINT NOT NULL, -- nanoseconds
+      bytes_in BIGINT NOT NULL,
+      bytes_out BIGINT NOT NULL,
+      error TEXT NOT NULL, -- empty unless the request couldn't be made
+      started_at DATETIME NOT NULL,
+      created_at DATETIME NOT NULL,
+      INDEX (run_id)
+    );`,
+		Down: `DROP TABLE run_results`,
+	},
+	{
+		Version: 6,
+		Name:    "add_position_to_transforms",
+		// the order an archive's transforms are applied in
+		Up:   `ALTER TABLE transforms ADD COLUMN position INT NOT NULL DEFAULT 0 AFTER archive_id`,
+		Down: `ALTER TABLE transforms DROP COLUMN position`,
+	},
+}
+
+// LatestVersion is the version the code expects the database to be at
+func LatestVersion() int {
+	return len(Migrations)
+}
+
+// Migrator is a Store with a schema that has to change along with the code.
+// The FileStore doesn't have one, it keeps whatever JSON it's given.
+type Migrator interface {
+	// SchemaVersion is the Version of the last Migration applied, 0 when
+	// none have been
+	SchemaVersion() (int, error)
+	// MigrateTo applies (or undoes) migrations until the schema is at the
+	// given version
+	MigrateTo(version int) error
+}
+
+// MigrationStep is one migration to apply, or to undo when Up is false
+type MigrationStep struct {
+	Migration
+	Up bool
+}
+
+// SQL is the statement that performs the step
+func (s MigrationStep) SQL() string {
+	if s.Up {
+		return s.Migration.Up
+	}
+	return s.Migration.Down
+}
+
+func (s MigrationStep) String() string {
+	direction := "down"
+	if s.Up {
+		direction = "up"
+	}
+	return fmt.Sprintf("%d_%s (%s)", s.Version, s.Name, direction)
+}
+
+// PlanMigration lists the steps that take a schema from one version to
+// another: every later migration's Up in order or every migration back to the
+// target's Down in reverse order.
+func PlanMigration(from, to int) ([]MigrationStep, error) {
+	if to < 0 || to > LatestVersion() {
+		return nil, fmt.Errorf("there is no schema version %d, the latest is %d", to, LatestVersion())
+	}
+	if from < 0 || from > LatestVersion() {
+		return nil, fmt.Errorf("the database is at schema version %d which this code doesn't know about, the latest is %d", from, LatestVersion())
+	}
+
+	var steps []MigrationStep
+	for version := from + 1; version <= to; version++ {
+		steps = append(steps, MigrationStep{Migration: Migrations[version-1], Up: true})
+	}
+	for version := from; version > to; version-- {
+		steps = append(steps, MigrationStep{Migration: Migrations[version-1], Up: false})
+	}
+	return steps, nil
+}
@@ -0,0 +1,64 @@
+package persistence
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestMigrationsAreNumberedInOrder(t *testing.T) {
+	for i, migration := range Migrations {
+		if migration.Version != i+1 {
+			t.Errorf("Expected migration %s to be version %d, got: %d", migration.Name, i+1, migration.Version)
+		}
+		if migration.Up == "" || migration.Down == "" {
+			t.Errorf("Expected migration %s to have both an up and a down step", migration.Name)
+		}
+	}
+}
+
+func TestPlanMigration(t *testing.T) {
+	steps, err := PlanMigration(1, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(steps) != 2 || steps[0].Version != 2 || steps[1].Version != 3 || !steps[0].Up || !steps[1].Up {
+		t.Errorf("Expected to apply 2 and then 3, got: %v", steps)
+	}
+
+	steps, err = PlanMigration(3, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(steps) != 2 || steps[0].Version != 3 || steps[1].Version != 2 || steps[0].Up || steps[1].Up {
+		t.Errorf("Expected to undo 3 and then 2, got: %v", steps)
+	}
+	if steps[0].SQL() != Migrations[2].Down {
+		t.Errorf("Expected undoing to run the down step, got: %s", steps[0].SQL())
+	}
+
+	steps, err = PlanMigration(LatestVersion(), LatestVersion())
+	if err != nil || len(steps) != 0 {
+		t.Errorf("Expected nothing to do, got: %v (%v)", steps, err)
+	}
+
+	if _, err := PlanMigration(0, LatestVersion()+1); err == nil {
+		t.Errorf("Expected an error migrating past the latest version")
+	}
+}
+
+func TestOpenMigratorForFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "traffic")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	migrator, err := OpenMigrator("file://"+dir, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if migrator != nil {
+		t.Errorf("Expected files to have no schema to migrate, got: %#v", migrator)
+	}
+}
@@ -0,0 +1,277 @@
+package persistence
+
+import (
+	"database/sql"
+	"fmt"
+
+	// The act of importing a database/sql driver modifies database/sql, you
+	// don't need to reference it unless you need access to things like
+	// mysql.Error
+	"github.com/go-sql-driver/mysql"
+	"github.com/square/squalor"
+)
+
+// MySQLStore is our wrapper around a Squalor connection. We define a few
+// methods but it delegates everything else to Squalor.
+type MySQLStore struct {
+	*squalor.DB
+
+	Archives   *squalor.Model
+	Transforms *squalor.Model
+	Runs       *squalor.Model
+	RunResults *squalor.Model
+
+	config *mysql.Config
+}
+
+var _ Store = &MySQLStore{}
+var _ Migrator = &MySQLStore{}
+
+// NewMySQLStore connects to MySQL with a go-sql-driver/mysql DSN (e.g.
+// "root:secret@tcp(db.internal:3306)/traffic"). An empty DSN connects as root
+// on localhost to the named database. The database is created and migrated to
+// the latest schema if necessary.
+func NewMySQLStore(dsn, databaseName string) (*MySQLStore, error) {
+	store, err := ConnectMySQL(dsn, databaseName)
+	if err != nil {
+		return nil, err
+	}
+
+	// TODO: when performance of this method becomes an issue move this to an
+	// external manual step
+	err = store.MigrateTo(LatestVersion())
+	if err != nil {
+		return nil, err
+	}
+
+	// Connect specific tables to specific struct types
+	store.Archives, err = store.BindModel("archives", Archive{})
+	if err == nil {
+		store.Transforms, err = store.BindModel("transforms", Transform{})
+	}
+	if err == nil {
+		store.Runs, err = store.BindModel("runs", Run{})
+	}
+	if err == nil {
+		store.RunResults, err = store.BindModel("run_results", RunResult{})
+	}
+	if err == nil {
+		return store, nil
+	}
+
+	switch err.(type) {
+	case *mysql.MySQLError:
+		fmt.Println(err.Error())
+	default:
+		fmt.Println(err.Error())
+	}
+	return nil, err
+}
+
+// ConnectMySQL connects without touching the schema. The store can only be
+// used for migrating until the tables have been bound, see NewMySQLStore.
+func ConnectMySQL(dsn, databaseName string) (*MySQLStore, error) {
+	if dsn == "" {
+		dsn = "root@/" + databaseName
+	}
+	config, err := mysql.ParseDSN(dsn)
+	if err != nil {
+		return nil, err
+	}
+	// Without this DATETIME columns can't be read into time.Time fields
+	config.ParseTime = true
+	dsn = config.FormatDSN()
+
+	// Connect to MySQL
+	conn, err := sql.Open("mysql", dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	// Wrap the MySQL connection in the Squalor ORM and wrap that in our own
+	// store type
+	newDB, err := squalor.NewDB(conn)
+	if err != nil {
+		return nil, err
+	}
+	return &MySQLStore{DB: newDB, config: config}, nil
+}
+
+// MySQL error numbers we handle
+const (
+	mysqlUnknownDatabase = 1049
+	mysqlDuplicateColumn = 1060
+)
+
+// mysqlMigrationsSchema keeps track of which Migrations have been applied
+const mysqlMigrationsSchema = `
+    CREATE TABLE IF NOT EXISTS schema_migrations (
+      version INT NOT NULL PRIMARY KEY,
+      name VARCHAR(255) NOT NULL,
+      applied_at DATETIME NOT NULL
+    );`
+
+// SchemaVersion is the Version of the last Migration applied, 0 when none
+// have been. It creates the database and the schema_migrations table if
+// they're missing.
+func (s *MySQLStore) SchemaVersion() (int, error) {
+	if err := s.createMigrationsTable(); err != nil {
+		return 0, err
+	}
+	var version int
+	err := s.DB.DB.QueryRow("SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&version)
+	return version, err
+}
+
+// MigrateTo applies (or undoes) migrations until the schema is at the given
+// version. Each step is recorded in schema_migrations as soon as it's done so
+// a failure partway leaves the database at a known version.
+func (s *MySQLStore) MigrateTo(version int) error {
+	current, err := s.SchemaVersion()
+	if err != nil {
+		return err
+	}
+	steps, err := PlanMigration(current, version)
+	if err != nil {
+		return err
+	}
+
+	for _, step := range steps {
+		err := MigrateSQL(s.DB.DB, step.SQL())
+		// Databases created before migrations were numbered already have the
+		// columns that used to be added straight to CREATE TABLE
+		if mysqlErr, ok := err.(*mysql.MySQLError); ok && step.Up && mysqlErr.Number == mysqlDuplicateColumn {
+			err = nil
+		}
+		if err != nil {
+			return fmt.Errorf("migrating %s: %s", step, err)
+		}
+
+		if step.Up {
+			_, err = s.DB.DB.Exec("INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, NOW())", step.Version, step.Name)
+		} else {
+			_, err = s.DB.DB.Exec("DELETE FROM schema_migrations WHERE version = ?", step.Version)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// createMigrationsTable will create the database if necessary and then the
+// table that tracks which migrations have been applied
+func (s *MySQLStore) createMigrationsTable() error {
+	err := MigrateSQL(s.DB.DB, mysqlMigrationsSchema)
+	if mysqlErr, ok := err.(*mysql.MySQLError); ok && mysqlErr.Number == mysqlUnknownDatabase {
+		// Connect without choosing a database and then run the CREATE
+		// DATABASE query
+		withoutDatabase := *s.config
+		withoutDatabase.DBName = ""
+		conn, err := sql.Open("mysql", withoutDatabase.FormatDSN())
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		err = MigrateSQL(conn, fmt.Sprintf("CREATE DATABASE %s", s.config.DBName))
+		if err != nil {
+			return err
+		}
+		// Create the table now that there's a database to put it in
+		return MigrateSQL(s.DB.DB, mysqlMigrationsSchema)
+	}
+	return err
+}
+
+// MigrateSQL performs a single DDL
+func MigrateSQL(conn *sql.DB, query string) error {
+	rows, err := conn.Query(query)
+	if err != nil {
+		fmt.Printf("error migrating: %s\n", err)
+		return err
+	}
+	rows.Next()
+	rows.Close()
+	return nil
+}
+
+// Insert persists new records and assigns their IDs
+func (s *MySQLStore) Insert(records ...Model) error {
+	list := make([]interface{}, len(records))
+	for i, record := range records {
+		list[i] = record
+	}
+	return s.DB.Insert(list...)
+}
+
+// Update overwrites the stored record that has the same ID
+func (s *MySQLStore) Update(record Model) (int64, error) {
+	return s.DB.Update(record)
+}
+
+// Delete removes the stored record that has the same ID
+func (s *MySQLStore) Delete(record Model) (int64, error) {
+	return s.DB.Delete(record)
+}
+
+// Get fills in the record with the stored one that has the same ID
+func (s *MySQLStore) Get(record Model) error {
+	err := s.DB.Get(record, recordID(record))
+	if err == sql.ErrNoRows {
+		return ErrNotFound
+	}
+	return err
+}
+
+// ListArchives returns all of the har records from the database as model
+// instances
+func (s *MySQLStore) ListArchives() ([]Archive, error) {
+	var records []Archive
+	err := s.Select(&records, s.Archives.Select("*"))
+	return records, err
+}
+
+// ListTransformsFor returns all of the transform records (instantiated as
+// appropriate Transform objects) for a given Archive id in the order they're
+// to be applied.
+func (s *MySQLStore) ListTransformsFor(archiveID int64) ([]Transform, error) {
+	var records []Transform
+	archiveIDColumn := s.Transforms.C("archive_id")
+	query := s.Transforms.Select("*").Where(archiveIDColumn.Eq(archiveID)).
+		OrderBy(s.Transforms.C("position").Ascending(), s.Transforms.C("id").Ascending())
+	err := s.Select(&records, query)
+	return records, err
+}
+
+// ListRuns returns every run, newest first. Pass an archive id to see only
+// the runs of that archive or 0 to see all of them.
+func (s *MySQLStore) ListRuns(archiveID int64) ([]Run, error) {
+	var records []Run
+	query := s.Runs.Select("*").OrderBy(s.Runs.C("id").Descending())
+	if archiveID != 0 {
+		query = query.Where(s.Runs.C("archive_id").Eq(archiveID))
+	}
+	err := s.Select(&records, query)
+	return records, err
+}
+
+// ListRunResultsFor returns the sampled results of a Run in the order they
+// were recorded
+func (s *MySQLStore) ListRunResultsFor(runID int64) ([]RunResult, error) {
+	var records []RunResult
+	runIDColumn := s.RunResults.C("run_id")
+	err := s.Select(&records, s.RunResults.Select("*").Where(runIDColumn.Eq(runID)).OrderBy(s.RunResults.C("id").Ascending()))
+	return records, err
+}
+
+// Truncate is a misnomer because for small (< 1 million) records "DELETE FROM
+// table" is faster than "TRUNCATE table" in MySQL as TRUNCATE operates at a
+// very slow O(1) and Delete is a more rapid O(n) for a very small n.
+func (s *MySQLStore) Truncate() {
+	for _, table := range []string{"archives", "transforms", "runs", "run_results"} {
+		_, err := s.Exec(fmt.Sprintf("DELETE FROM %s", table))
+		if err != nil {
+			panic(err)
+		}
+	}
+}
@@ -1,25 +1,42 @@
 package persistence
 
 import (
-	"database/sql"
+	"errors"
 	"fmt"
-
-	// The act of importing a database/sql driver modifies database/sql, you
-	// don't need to reference it unless you need access to things like
-	// mysql.Error
-	"github.com/go-sql-driver/mysql"
-	"github.com/square/squalor"
+	"os"
+	"path/filepath"
+	"strings"
 
 	"github.com/JackDanger/traffic/util"
 )
 
-// DB is our wrapper around a Squalor connection. We define a few methods but
-// it delegates everything else to Squalor.
+// DB is the handle we use for every database operation. It delegates to
+// whichever Store it was opened with so the rest of the code doesn't need to
+// care whether records end up in MySQL or in files on disk.
 type DB struct {
-	*squalor.DB
+	Store
+}
 
-	Archives   *squalor.Model
-	Transforms *squalor.Model
+// Store is somewhere records can be kept. MySQLStore and FileStore are the
+// two kinds there are.
+type Store interface {
+	// Insert persists new records and assigns their IDs
+	Insert(records ...Model) error
+	// Update overwrites the stored record that has the same ID
+	Update(record Model) (int64, error)
+	// Delete removes the stored record that has the same ID
+	Delete(record Model) (int64, error)
+	// Get fills in the record with the stored one that has the same ID
+	Get(record Model) error
+
+	ListArchives() ([]Archive, error)
+	// ListTransformsFor is in the order the transforms are to be applied
+	ListTransformsFor(archiveID int64) ([]Transform, error)
+	ListRuns(archiveID int64) ([]Run, error)
+	ListRunResultsFor(runID int64) ([]RunResult, error)
+
+	// Truncate removes every record, it's for tests
+	Truncate()
 }
 
 // Model is what we'll call any type that represents the individual records in
@@ -27,14 +44,53 @@ type DB struct {
 type Model interface {
 	AsJSON() []byte
 	Create(*DB) error
-	Schema() string
 }
 
 var _ Model = &Archive{}
 var _ Model = &Transform{}
+var _ Model = &Run{}
+var _ Model = &RunResult{}
+
+// recordID is the primary key of any of our records
+func recordID(record Model) int64 {
+	switch r := record.(type) {
+	case *Archive:
+		return r.ID
+	case *Transform:
+		return r.ID
+	case *Run:
+		return r.ID
+	case *RunResult:
+		return r.ID
+	}
+	panic(fmt.Sprintf("unknown record type: %T", record))
+}
+
+// setRecordID assigns the primary key of a newly inserted record
+func setRecordID(record Model, id int64) {
+	switch r := record.(type) {
+	case *Archive:
+		r.ID = id
+	case *Transform:
+		r.ID = id
+	case *Run:
+		r.ID = id
+	case *RunResult:
+		r.ID = id
+	default:
+		panic(fmt.Sprintf("unknown record type: %T", record))
+	}
+}
+
+// ErrNotFound is returned by Get when there's no record with that ID
+var ErrNotFound = errors.New("record not found")
+
+// DSNVariable is the environment variable NewDb reads the DSN from
+const DSNVariable = "TRAFFIC_DB"
 
 // NewDb returns an instance of a single connection to the database. It's the
-// handle we use for performing every database operation.
+// handle we use for performing every database operation. The database is
+// chosen by the TRAFFIC_DB environment variable, see Open.
 func NewDb() (*DB, error) {
 	return NewDbForEnv(util.EnvironmentGuess())
 }
@@ -42,96 +98,61 @@ func NewDb() (*DB, error) {
 // NewDbForEnv allows us to create multiple databases for development, test,
 // staging, or production from the same code base.
 func NewDbForEnv(environment string) (*DB, error) {
-	databaseName := fmt.Sprintf("traffic_%s", environment)
-
-	// Connect to MySQL
-	conn, err := sql.Open("mysql", "root@/mysql?parseTime=true")
-	if err != nil {
-		return nil, err
-	}
-
-	// Wrap the MySQL connection in the Squalor ORM and wrap that in our own DB
-	// type
-	newDB, err := squalor.NewDB(conn)
-	if err != nil {
-		fmt.Println("persistence/persistence.go:49 ", err)
-	}
-	db := &DB{DB: newDB}
+	return OpenForEnv(os.Getenv(DSNVariable), environment)
+}
 
-	// TODO: when performance of this method becomes an issue move this to an
-	// external manual step
-	err = db.Migrate(databaseName)
-	if err != nil {
-		fmt.Println("persistence/persistence.go:49 ", err)
-	}
+// Open connects to the database described by the DSN:
+//
+//   file:///var/lib/traffic  records kept as JSON files in that directory
+//   mysql://root@/traffic    MySQL, with a go-sql-driver/mysql DSN
+//   mysql://                 MySQL as root on localhost in traffic_<environment>
+//   (empty)                  JSON files in ~/.traffic/traffic_<environment>
+//
+func Open(dsn string) (*DB, error) {
+	return OpenForEnv(dsn, util.EnvironmentGuess())
+}
 
-	// Connect specific tables to specific struct types
-	archives, err := db.BindModel("archives", Archive{})
-	transforms, err := db.BindModel("transforms", Transform{})
-	db.Archives = archives
-	db.Transforms = transforms
-	if err == nil {
-		return db, nil
-	}
+// OpenForEnv is Open with the environment spelled out, it only matters when
+// the DSN doesn't name a database.
+func OpenForEnv(dsn, environment string) (*DB, error) {
+	databaseName := fmt.Sprintf("traffic_%s", environment)
 
-	switch err.(type) {
-	case *mysql.MySQLError:
-		fmt.Println(err.Error())
+	var store Store
+	var err error
+	switch {
+	case dsn == "":
+		store, err = NewFileStore(defaultFileStorePath(databaseName))
+	case strings.HasPrefix(dsn, "file://"):
+		store, err = NewFileStore(strings.TrimPrefix(dsn, "file://"))
+	case strings.HasPrefix(dsn, "mysql://"):
+		store, err = NewMySQLStore(strings.TrimPrefix(dsn, "mysql://"), databaseName)
 	default:
-		fmt.Println(err.Error())
+		err = fmt.Errorf("don't know how to open %q, expected file://... or mysql://...", dsn)
 	}
-	return nil, err
+	if err != nil {
+		return nil, err
+	}
+	return &DB{Store: store}, nil
 }
 
-// Migrate will create the database if necessary and apply necessary
-// migrations.
-func (db *DB) Migrate(databaseName string) error {
-	// Create the tables if necessary
-	err := MigrateSQL(db.DB.DB, Archive{}.Schema())
-	if err == nil {
-		err = MigrateSQL(db.DB.DB, Transform{}.Schema())
+// OpenMigrator connects to the database described by the DSN (see Open)
+// without migrating it. It's nil for stores that don't have a schema.
+func OpenMigrator(dsn, environment string) (Migrator, error) {
+	if strings.HasPrefix(dsn, "mysql://") {
+		return ConnectMySQL(strings.TrimPrefix(dsn, "mysql://"), fmt.Sprintf("traffic_%s", environment))
 	}
-	switch err.(type) {
-	case *mysql.MySQLError:
-		// "database does not exist" error
-		if err.(*mysql.MySQLError).Number == 0x419 {
-			// Connect to a db that we know exists and then run the CREATE DATABASE
-			// query
-			conn, err := sql.Open("mysql", "root@/mysql?parseTime=true")
-			if err != nil {
-				return err
-			}
-			err = MigrateSQL(conn, fmt.Sprintf("CREATE DATABASE  %s", databaseName))
-			if err != nil {
-				return err
-			}
-			// Create the tables if we just created the database
-			err = MigrateSQL(db.DB.DB, Archive{}.Schema())
-		}
+	// Make sure it's a DSN we understand even though there's nothing to do
+	if _, err := OpenForEnv(dsn, environment); err != nil {
+		return nil, err
 	}
-	return err
+	return nil, nil
 }
 
-// MigrateSQL performs a single DDL
-func MigrateSQL(conn *sql.DB, query string) error {
-	rows, err := conn.Query(query)
+// defaultFileStorePath is where records go when nobody says otherwise
+func defaultFileStorePath(databaseName string) string {
+	home, err := os.UserHomeDir()
 	if err != nil {
-		fmt.Printf("error migrating: %s\n", err)
-		return err
-	}
-	rows.Next()
-	rows.Close()
-	return nil
-}
-
-// Truncate is a misnomer because for small (< 1 million) records "DELETE FROM
-// table" is faster than "TRUNCATE table" in MySQL as TRUNCATE operates at a
-// very slow O(1) and Delete is a more rapid O(n) for a very small n.
-func (db *DB) Truncate() {
-	for _, table := range []string{"archives", "transforms"} {
-		_, err := db.Exec(fmt.Sprintf("DELETE FROM %s", table))
-		if err != nil {
-			panic(err)
-		}
+		home = os.TempDir()
 	}
+	return filepath.Join(home, ".traffic", databaseName)
 }
@@ -1,15 +1,27 @@
 package persistence
 
 import (
+	"io/ioutil"
 	"os"
+	"strings"
 	"testing"
 )
 
 var db *DB
 
 func TestMain(m *testing.M) {
-	// Creates the database if necessary
+	// Keep records in a directory of our own unless we've been asked to test
+	// against MySQL. Other packages' tests run at the same time.
 	var err error
+	dir := ""
+	if !strings.HasPrefix(os.Getenv(DSNVariable), "mysql://") {
+		if dir, err = ioutil.TempDir("", "traffic"); err != nil {
+			panic(err)
+		}
+		os.Setenv(DSNVariable, "file://"+dir)
+	}
+
+	// Creates the database if necessary
 	db, err = NewDb()
 	if err != nil {
 		panic(err)
@@ -18,6 +30,9 @@ func TestMain(m *testing.M) {
 	exitCode := m.Run()
 
 	db.Truncate()
+	if dir != "" {
+		os.RemoveAll(dir)
+	}
 
 	os.Exit(exitCode)
 }
@@ -0,0 +1,100 @@
+package persistence
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/JackDanger/traffic/runner"
+	"github.com/JackDanger/traffic/util"
+)
+
+// Run is the database record of a single load test: which archive was
+// replayed, by whom, how hard, and how it went. It's created when the run
+// starts and updated with the final numbers once it's done so that past load
+// tests can be compared.
+type Run struct {
+	ID          int64      `json:"id" db:"id"`
+	RunID       string     `json:"run_id" db:"run_id"` // the runner.Group ID, as used by the /runs endpoints
+	ArchiveID   int64      `json:"archive_id" db:"archive_id"`
+	StartedBy   string     `json:"started_by" db:"started_by"`
+	Concurrency int        `json:"concurrency" db:"concurrency"`
+	Iterations  int        `json:"iterations" db:"iterations"`
+	Velocity    float64    `json:"velocity" db:"velocity"`
+	State       string     `json:"state" db:"state"` // see runner.GroupState
+	Requests    int        `json:"requests" db:"requests"`
+	Errors      int        `json:"errors" db:"errors"`
+	P50         int64      `json:"p50" db:"p50"` // nanoseconds
+	P90         int64      `json:"p90" db:"p90"`
+	P99         int64      `json:"p99" db:"p99"`
+	Throughput  float64    `json:"throughput" db:"throughput"` // requests per second
+	Summary     string     `json:"summary" db:"summary"`       // the whole runner.Summary as JSON
+	StartedAt   *time.Time `json:"started_at" db:"started_at"`
+	EndedAt     *time.Time `json:"ended_at" db:"ended_at"`
+	CreatedAt   *time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt   *time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// MakeRun prepares a record of a Group that's about to be started
+func MakeRun(group *runner.Group, startedBy string) *Run {
+	return &Run{
+		RunID:       group.ID,
+		ArchiveID:   group.ArchiveID,
+		StartedBy:   startedBy,
+		Concurrency: group.Concurrency,
+		Iterations:  group.Iterations,
+		Velocity:    group.Velocity,
+		State:       string(runner.GroupRunning),
+		Summary:     "{}",
+		StartedAt:   util.TimePtr(time.Now()),
+	}
+}
+
+// Get retrieves a single record by primary key
+func (r Run) Get(db *DB, id int64) (*Run, error) {
+	run := &Run{}
+	run.ID = id
+	err := db.Get(run)
+	return run, err
+}
+
+// Create persists a single Run.
+func (r *Run) Create(db *DB) error {
+	if r.CreatedAt != nil {
+		return errors.New("Run already appears to be persisted")
+	}
+
+	now := util.TimePtr(time.Now())
+	r.CreatedAt = now
+	r.UpdatedAt = now
+	return db.Insert(r)
+}
+
+// Finish records how the run ended
+func (r *Run) Finish(db *DB, status runner.GroupStatus) error {
+	summary, err := json.Marshal(status.Summary)
+	if err != nil {
+		return err
+	}
+	r.State = string(status.State)
+	r.Requests = status.Summary.Requests
+	r.Errors = status.Summary.Errors
+	r.P50 = int64(status.Summary.P50)
+	r.P90 = int64(status.Summary.P90)
+	r.P99 = int64(status.Summary.P99)
+	r.Throughput = status.Summary.Throughput
+	r.Summary = string(summary)
+	r.EndedAt = status.EndTime
+	if r.EndedAt == nil {
+		r.EndedAt = util.TimePtr(time.Now())
+	}
+	r.UpdatedAt = util.TimePtr(time.Now())
+	_, err = db.Update(r)
+	return err
+}
+
+// AsJSON represents the run as a whole in JSON.
+func (r *Run) AsJSON() []byte {
+	j, _ := json.MarshalIndent(r, "", "  ")
+	return j
+}
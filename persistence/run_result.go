@@ -0,0 +1,181 @@
+package persistence
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/JackDanger/traffic/runner"
+	"github.com/JackDanger/traffic/util"
+)
+
+// RunResult is the database record of a single replayed entry from a Run.
+// Load tests make far too many requests to keep them all so only a sample of
+// them is stored, see RunRecorder.
+type RunResult struct {
+	ID         int64      `json:"id" db:"id"`
+	RunID      int64      `json:"run_id" db:"run_id"` // the Run's ID
+	EntryIndex int        `json:"entry_index" db:"entry_index"`
+	Method     string     `json:"method" db:"method"`
+	URL        string     `json:"url" db:"url"`
+	Status     int        `json:"status" db:"status"`
+	TTFB       int64      `json:"ttfb" db:"ttfb"`   // nanoseconds
+	Total      int64      `json:"total" db:"total"` // nanoseconds
+	BytesIn    int64      `json:"bytes_in" db:"bytes_in"`
+	BytesOut   int64      `json:"bytes_out" db:"bytes_out"`
+	Error      string     `json:"error" db:"error"`
+	StartedAt  *time.Time `json:"started_at" db:"started_at"`
+	CreatedAt  *time.Time `json:"created_at" db:"created_at"`
+}
+
+// MakeRunResult prepares a runner.Result to be stored as part of a Run
+func MakeRunResult(runID int64, result runner.Result) *RunResult {
+	return &RunResult{
+		RunID:      runID,
+		EntryIndex: result.EntryIndex,
+		Method:     result.Method,
+		URL:        result.URL,
+		Status:     result.Status,
+		TTFB:       int64(result.TTFB),
+		Total:      int64(result.Total),
+		BytesIn:    result.BytesIn,
+		BytesOut:   result.BytesOut,
+		Error:      result.Error,
+		StartedAt:  util.TimePtr(result.StartTime),
+	}
+}
+
+// Create persists a single RunResult.
+func (r *RunResult) Create(db *DB) error {
+	if r.CreatedAt != nil {
+		return errors.New("RunResult already appears to be persisted")
+	}
+
+	r.CreatedAt = util.TimePtr(time.Now())
+	return db.Insert(r)
+}
+
+// AsJSON represents the result as a whole in JSON.
+func (r *RunResult) AsJSON() []byte {
+	j, _ := json.MarshalIndent(r, "", "  ")
+	return j
+}
+
+// RunRecorder stores a Run's results as they come in. Every failure is kept,
+// up to MaxFailures, but only one in every SampleEvery successes.
+//
+// Recording a result never waits on the database: results are handed to a
+// goroutine that stores them in batches, and if it falls more than a
+// recorderBuffer behind the results are dropped rather than slowing the run.
+type RunRecorder struct {
+	SampleEvery int
+	MaxFailures int // set it before the first Record
+
+	db       *DB
+	run      *Run
+	results  chan *RunResult
+	stored   chan struct{} // closed once every result has been stored
+	seen     int64
+	failures int64
+	dropped  int64
+	m        sync.Mutex
+	errs     []error
+}
+
+const (
+	// DefaultMaxFailures is how many failures a RunRecorder stores per run
+	DefaultMaxFailures = 1000
+	recorderBuffer     = 1000
+	recorderBatch      = 100
+)
+
+// NewRunRecorder records results for a Run that's already been created
+func NewRunRecorder(db *DB, run *Run, sampleEvery int) *RunRecorder {
+	if sampleEvery < 1 {
+		sampleEvery = 1
+	}
+	r := &RunRecorder{
+		SampleEvery: sampleEvery,
+		MaxFailures: DefaultMaxFailures,
+		db:          db,
+		run:         run,
+		results:     make(chan *RunResult, recorderBuffer),
+		stored:      make(chan struct{}),
+	}
+	go r.write()
+	return r
+}
+
+// Record queues the result to be stored if it's part of the sample. It's
+// safe to call from many goroutines, e.g. as a runner.Group's OnResult, but
+// not after Finish.
+func (r *RunRecorder) Record(result runner.Result) {
+	seen := atomic.AddInt64(&r.seen, 1)
+	if result.Failed() {
+		if atomic.AddInt64(&r.failures, 1) > int64(r.MaxFailures) {
+			return
+		}
+	} else if (seen-1)%int64(r.SampleEvery) != 0 {
+		return
+	}
+	select {
+	case r.results <- MakeRunResult(r.run.ID, result):
+	default:
+		atomic.AddInt64(&r.dropped, 1)
+	}
+}
+
+// write stores the queued results, as many at a time as are waiting (up to
+// a recorderBatch), until Finish
+func (r *RunRecorder) write() {
+	defer close(r.stored)
+	for result := range r.results {
+		batch := []Model{result}
+	gather:
+		for len(batch) < recorderBatch {
+			select {
+			case more, ok := <-r.results:
+				if !ok {
+					break gather
+				}
+				batch = append(batch, more)
+			default:
+				break gather
+			}
+		}
+
+		now := util.TimePtr(time.Now())
+		for _, each := range batch {
+			each.(*RunResult).CreatedAt = now
+		}
+		if err := r.db.Insert(batch...); err != nil {
+			r.m.Lock()
+			r.errs = append(r.errs, err)
+			r.m.Unlock()
+		}
+	}
+}
+
+// Finish waits for the sampled results to be stored and updates the Run
+// with how the Group ended. It also reports the first error, if any, from
+// storing the sampled results.
+func (r *RunRecorder) Finish(status runner.GroupStatus) error {
+	close(r.results)
+	<-r.stored
+
+	if err := r.run.Finish(r.db, status); err != nil {
+		return err
+	}
+	r.m.Lock()
+	defer r.m.Unlock()
+	if len(r.errs) > 0 {
+		return r.errs[0]
+	}
+	if dropped := atomic.LoadInt64(&r.dropped); dropped > 0 {
+		return fmt.Errorf("%d sampled results weren't stored, the database couldn't keep up", dropped)
+	}
+	return nil
+}
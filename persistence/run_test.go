@@ -0,0 +1,107 @@
+package persistence
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/JackDanger/traffic/model"
+	"github.com/JackDanger/traffic/runner"
+)
+
+func TestRunRecorder(t *testing.T) {
+	group := runner.NewGroup(&model.Har{}, 4, 2, 1.5)
+	group.ArchiveID = 12
+	run := MakeRun(group, "someone@example.com")
+	if err := run.Create(db); err != nil {
+		t.Fatal(err)
+	}
+
+	recorder := NewRunRecorder(db, run, 3)
+	for i := 0; i < 7; i++ {
+		recorder.Record(runner.Result{EntryIndex: i, Method: "GET", URL: "http://localhost/", Status: 200, Total: time.Millisecond, StartTime: time.Now()})
+	}
+	recorder.Record(runner.Result{EntryIndex: 7, Method: "GET", URL: "http://localhost/", Error: "connection refused", StartTime: time.Now()})
+
+	end := time.Now()
+	err := recorder.Finish(runner.GroupStatus{
+		State:   runner.GroupFinished,
+		EndTime: &end,
+		Summary: runner.Summary{Requests: 8, Errors: 1, P50: time.Millisecond, StatusCodes: map[int]int{200: 7}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stored, err := Run{}.Get(db, run.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.StartedBy != "someone@example.com" || stored.ArchiveID != 12 || stored.Concurrency != 4 || stored.Iterations != 2 {
+		t.Errorf("Expected the run's parameters to be stored, got: %#v", stored)
+	}
+	if stored.State != "finished" || stored.Requests != 8 || stored.Errors != 1 || stored.P50 != int64(time.Millisecond) {
+		t.Errorf("Expected the run's outcome to be stored, got: %#v", stored)
+	}
+	if stored.EndedAt == nil {
+		t.Errorf("Expected the run to have ended")
+	}
+	summary := runner.Summary{}
+	if err := json.Unmarshal([]byte(stored.Summary), &summary); err != nil {
+		t.Fatal(err)
+	}
+	if summary.StatusCodes[200] != 7 {
+		t.Errorf("Expected the whole summary to be stored, got: %s", stored.Summary)
+	}
+
+	results, err := db.ListRunResultsFor(run.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Successes 0, 3 and 6 plus the failure
+	if len(results) != 4 {
+		t.Fatalf("Expected 4 sampled results, got: %d", len(results))
+	}
+	if results[3].EntryIndex != 7 || results[3].Error != "connection refused" {
+		t.Errorf("Expected every failure to be stored, got: %#v", results[3])
+	}
+
+	runs, err := db.ListRuns(12)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Newest first, after any runs of archive 12 from earlier tests
+	if len(runs) == 0 || runs[0].ID != run.ID {
+		t.Errorf("Expected to find the run by its archive, got: %#v", runs)
+	}
+}
+
+func TestRunRecorderLimitsFailures(t *testing.T) {
+	run := MakeRun(runner.NewGroup(&model.Har{}, 1, 1, 1.0), "someone@example.com")
+	if err := run.Create(db); err != nil {
+		t.Fatal(err)
+	}
+
+	recorder := NewRunRecorder(db, run, 1)
+	recorder.MaxFailures = 2
+	for i := 0; i < 5; i++ {
+		recorder.Record(runner.Result{EntryIndex: i, Error: "connection refused", StartTime: time.Now()})
+	}
+	recorder.Record(runner.Result{EntryIndex: 5, Status: 200, StartTime: time.Now()})
+	if err := recorder.Finish(runner.GroupStatus{State: runner.GroupFinished}); err != nil {
+		t.Fatal(err)
+	}
+
+	results, err := db.ListRunResultsFor(run.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 3 || results[1].EntryIndex != 1 || results[2].EntryIndex != 5 {
+		t.Errorf("Expected the first 2 failures and the success to be stored, got: %#v", results)
+	}
+	for _, result := range results {
+		if result.CreatedAt == nil {
+			t.Errorf("Expected every result to be marked as created, got: %#v", result)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package persistence
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+
+	"gopkg.in/yaml.v2"
+)
+
+// TransformsFromFile reads a list of transforms from a YAML (or JSON, which
+// is also YAML) file so they can be used without storing them first. Each
+// one has a `type`, the same as Transform.Type, alongside its settings:
+//
+//   - type: HeaderInjectionTransform
+//     key: Authorization
+//     value: Bearer abc123
+//   - type: BodyToHeaderTransform
+//     pattern: '"token": "(\w+)"'
+//     header_name: X-Token
+//
+// They're applied in the order they're listed.
+func TransformsFromFile(path string, archiveID int64) ([]Transform, error) {
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return TransformsFromYAML(contents, archiveID)
+}
+
+// TransformsFromYAML is TransformsFromFile for what's already been read
+func TransformsFromYAML(contents []byte, archiveID int64) ([]Transform, error) {
+	var listed []map[string]interface{}
+	if err := yaml.Unmarshal(contents, &listed); err != nil {
+		return nil, err
+	}
+
+	records := []Transform{}
+	for i, settings := range listed {
+		transformType, ok := settings["type"].(string)
+		if !ok || transformType == "" {
+			return nil, fmt.Errorf("transform #%d doesn't have a type", i+1)
+		}
+		delete(settings, "type")
+		marshaled, err := json.MarshalIndent(jsonCompatible(settings), "", "  ")
+		if err != nil {
+			return nil, fmt.Errorf("transform #%d (%s): %s", i+1, transformType, err)
+		}
+		record := Transform{
+			ArchiveID:     archiveID,
+			Position:      i,
+			Type:          transformType,
+			MarshaledJSON: string(marshaled),
+		}
+		if err := record.Validate(); err != nil {
+			return nil, fmt.Errorf("transform #%d (%s): %s", i+1, transformType, err)
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// jsonCompatible converts the map[interface{}]interface{} that YAML nests
+// maps as into map[string]interface{} so they can be marshaled to JSON
+func jsonCompatible(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[interface{}]interface{}:
+		converted := map[string]interface{}{}
+		for key, inner := range v {
+			converted[fmt.Sprint(key)] = jsonCompatible(inner)
+		}
+		return converted
+	case map[string]interface{}:
+		converted := map[string]interface{}{}
+		for key, inner := range v {
+			converted[key] = jsonCompatible(inner)
+		}
+		return converted
+	case []interface{}:
+		converted := make([]interface{}, len(v))
+		for i, inner := range v {
+			converted[i] = jsonCompatible(inner)
+		}
+		return converted
+	}
+	return value
+}
@@ -0,0 +1,66 @@
+package persistence
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/JackDanger/traffic/transforms"
+)
+
+func TestTransformsFromYAML(t *testing.T) {
+	records, err := TransformsFromYAML([]byte(`
+- type: HeaderInjectionTransform
+  key: Authorization
+  value: Bearer abc123
+- type: BodyToHeaderTransform
+  pattern: '"token": "(\w+)"'
+  header_name: X-Token
+`), 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("Expected 2 transforms, got: %d", len(records))
+	}
+	if records[0].ArchiveID != 4 || records[0].Position != 0 || records[1].Position != 1 {
+		t.Errorf("Expected the transforms in the order they're listed, got: %#v", records)
+	}
+	model, err := records[0].Model()
+	if err != nil {
+		t.Fatal(err)
+	}
+	injection := model.(*transforms.HeaderInjectionTransform)
+	if injection.Key != "Authorization" || injection.Value != "Bearer abc123" {
+		t.Errorf("Expected the settings to be kept, got: %#v", injection)
+	}
+	model, err = records[1].Model()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pattern := model.(*transforms.BodyToHeaderTransform).Pattern; pattern != `"token": "(\w+)"` {
+		t.Errorf("Expected the pattern to be kept as written, got: %s", pattern)
+	}
+}
+
+func TestTransformsFromJSON(t *testing.T) {
+	records, err := TransformsFromYAML([]byte(`[{"type": "ConstantTransform", "search": "GUID1", "replace": "abc"}]`), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 || records[0].Type != "ConstantTransform" {
+		t.Errorf("Expected JSON to be read too, got: %#v", records)
+	}
+}
+
+func TestTransformsFromYAMLErrors(t *testing.T) {
+	for yaml, expected := range map[string]string{
+		`- key: X-Missing-Type`: "#1 doesn't have a type",
+		"- type: ConstantTransform\n  search: a\n  replace: b\n- type: Bogus": "#2 (Bogus): unknown transform type",
+		"- type: ConstantTransform\n  search: a\n  replace: b\n  replcae: c":  "#1 (ConstantTransform): json: unknown field \"replcae\"",
+	} {
+		_, err := TransformsFromYAML([]byte(yaml), 0)
+		if err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("Expected an error about %q, got: %v", expected, err)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package persistence
 
 import (
 	"encoding/json"
+	"strings"
 	"testing"
 	"time"
 
@@ -106,7 +107,43 @@ func TestTransformModel(t *testing.T) {
 }
 
 func TestListTransformsFor(t *testing.T) {
-	//db.Transforms.Select("*").Where(db.Transforms.C("archive_id").Eq(archive.ID))
+	archive := &Archive{Name: "ordered"}
+	if err := archive.Create(db); err != nil {
+		t.Fatal(err)
+	}
+	// Created out of order, and with two sharing a position
+	for _, transform := range []struct {
+		key      string
+		position int
+	}{{"third", 2}, {"first", 1}, {"fourth", 2}, {"second", 1}} {
+		record, err := MakeTransformFor(archive.ID, transforms.HeaderInjectionTransform{Key: transform.key})
+		if err != nil {
+			t.Fatal(err)
+		}
+		record.Position = transform.position
+		if err := record.Create(db); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Some other archive's transform
+	other, _ := MakeTransformFor(archive.ID+1, transforms.HeaderInjectionTransform{Key: "other"})
+	if err := other.Create(db); err != nil {
+		t.Fatal(err)
+	}
 
-	//err := db.Select(&records, db.Archives.Select("*"))
+	records, err := db.ListTransformsFor(archive.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := []string{}
+	for _, record := range records {
+		model, err := record.Model()
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys = append(keys, model.(*transforms.HeaderInjectionTransform).Key)
+	}
+	if strings.Join(keys, ",") != "first,second,third,fourth" {
+		t.Errorf("Expected the archive's transforms by position then creation, got: %v", keys)
+	}
 }
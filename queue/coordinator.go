@@ -0,0 +1,350 @@
+package queue
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/JackDanger/traffic/runner"
+	"github.com/JackDanger/traffic/util"
+)
+
+// Coordinator is a Queue that spreads each job across every worker it knows
+// about. Pushing "archive 12 at 500 concurrent sessions" when there are four
+// live workers queues four parts of 125 sessions, one for each worker.
+//
+// Workers are known by their heartbeats (asking for a job or reporting
+// results counts as one). When a worker hasn't been heard from in longer than
+// Timeout, Rebalance hands the sessions it was running to the workers that
+// are left. The Status of a job merges the results from all of its parts into
+// one report. A job is forgotten once its queue has forgotten every part (see
+// MemoryQueue.Retention).
+type Coordinator struct {
+	Timeout time.Duration // how long a worker may go quiet before it's considered gone
+
+	m       sync.Mutex
+	queue   *MemoryQueue // holds the parts, one per worker
+	workers map[string]time.Time
+	splits  map[string]*split
+	partOf  map[string]*split // part ID => the split it belongs to
+}
+
+// split is a job that's been divided among workers
+type split struct {
+	job     *Job
+	started time.Time
+	parts   []*part
+	stats   *runner.Stats
+}
+
+// part is the share of a split assigned to one worker
+type part struct {
+	job       *Job
+	done      bool
+	abandoned bool // its worker disappeared and its sessions were reassigned
+}
+
+// WorkerStatus describes a worker the Coordinator has heard from
+type WorkerStatus struct {
+	Name     string    `json:"name"`
+	LastSeen time.Time `json:"last_seen"`
+	Sessions int       `json:"sessions"` // how many sessions it's been assigned and not finished
+}
+
+var _ Queue = &Coordinator{}
+
+// ErrAbandoned is what Report returns to a worker whose part of a job was
+// handed to other workers after it went quiet. The worker should stop.
+var ErrAbandoned = errors.New("this part of the job was reassigned to other workers")
+
+// NewCoordinator returns a Coordinator with no workers and no jobs
+func NewCoordinator(timeout time.Duration) *Coordinator {
+	return &Coordinator{
+		Timeout: timeout,
+		queue:   NewMemoryQueue(),
+		workers: map[string]time.Time{},
+		splits:  map[string]*split{},
+		partOf:  map[string]*split{},
+	}
+}
+
+// Push divides the job's concurrency among the live workers. If there aren't
+// any yet the whole job goes to whichever worker shows up first.
+func (c *Coordinator) Push(job *Job) error {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	c.expire()
+	if job.ID == "" {
+		job.ID = util.UUID()
+	}
+	if _, ok := c.splits[job.ID]; ok {
+		return fmt.Errorf("job %s is already queued", job.ID)
+	}
+	s := &split{job: job, started: time.Now(), stats: runner.NewStats()}
+	c.splits[job.ID] = s
+	return c.assign(s, job.Concurrency, job.Duration, c.live(time.Now()))
+}
+
+// Pop hands the worker its next part of a job. A part that was queued before
+// there were any workers belongs to whoever takes it, so that it's reassigned
+// if they go quiet.
+func (c *Coordinator) Pop(worker string) (*Job, error) {
+	c.Heartbeat(worker)
+	job, err := c.queue.Pop(worker)
+	if job == nil || err != nil {
+		return job, err
+	}
+
+	c.m.Lock()
+	defer c.m.Unlock()
+	if job.Worker == "" {
+		job.Worker = worker
+	}
+	return job, nil
+}
+
+// Report records a batch of results for a part and for the job it's part of.
+// Reports from workers whose share has already been handed to someone else
+// are dropped so nothing is counted twice, and ErrAbandoned tells them to stop.
+func (c *Coordinator) Report(report *Report) error {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	if report.Worker != "" {
+		c.workers[report.Worker] = time.Now()
+	}
+	s, ok := c.partOf[report.JobID]
+	if !ok {
+		return fmt.Errorf("no such job: %s", report.JobID)
+	}
+	p := s.part(report.JobID)
+	if p.abandoned {
+		return ErrAbandoned
+	}
+	if err := c.queue.Report(report); err != nil {
+		return err
+	}
+	for _, result := range report.Results {
+		s.stats.Add(result)
+	}
+	if report.Done {
+		p.done = true
+	}
+	return nil
+}
+
+// Status merges the results of every part of a job. The status of each part
+// is listed in Parts. Asking for the ID of a part describes just that part.
+func (c *Coordinator) Status(jobID string) (*Status, error) {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	c.expire()
+	s, ok := c.splits[jobID]
+	if !ok {
+		return c.queue.Status(jobID)
+	}
+	status := &Status{
+		Job:     s.job,
+		Done:    true,
+		Summary: s.stats.Summary(),
+	}
+	for _, p := range s.parts {
+		partStatus, err := c.queue.Status(p.job.ID)
+		if err != nil && (p.done || p.abandoned) {
+			// The queue only forgets parts that are over, the split's stats
+			// already include its results
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		status.Parts = append(status.Parts, partStatus)
+		if p.abandoned {
+			continue
+		}
+		if !p.done {
+			status.Done = false
+		}
+		if partStatus.Error != "" && status.Error == "" {
+			status.Error = partStatus.Error
+		}
+	}
+	return status, nil
+}
+
+// Heartbeat marks the worker as alive
+func (c *Coordinator) Heartbeat(worker string) error {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	c.workers[worker] = time.Now()
+	return nil
+}
+
+// Workers lists every worker that's still considered alive
+func (c *Coordinator) Workers() []WorkerStatus {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	statuses := []WorkerStatus{}
+	for _, name := range c.live(time.Now()) {
+		status := WorkerStatus{Name: name, LastSeen: c.workers[name]}
+		for _, s := range c.splits {
+			for _, p := range s.parts {
+				if p.job.Worker == name && !p.done && !p.abandoned {
+					status.Sessions += p.job.Concurrency
+				}
+			}
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
+
+// Rebalance forgets workers that have gone quiet and reassigns the sessions
+// they hadn't finished to the workers that are left. The reassigned sessions
+// run for whatever remains of the job's duration (or for one more pass
+// through the archive if the job has no duration). It returns the names of
+// the workers it gave up on.
+func (c *Coordinator) Rebalance() []string {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	now := time.Now()
+	gone := []string{}
+	for name, seen := range c.workers {
+		if now.Sub(seen) > c.Timeout {
+			gone = append(gone, name)
+			delete(c.workers, name)
+		}
+	}
+	sort.Strings(gone)
+	if len(gone) == 0 {
+		return gone
+	}
+
+	live := c.live(now)
+	for _, name := range gone {
+		for _, s := range c.splits {
+			orphaned := 0
+			for _, p := range s.parts {
+				if p.job.Worker != name || p.done || p.abandoned {
+					continue
+				}
+				p.abandoned = true
+				orphaned += p.job.Concurrency
+				c.queue.cancel(p.job.ID)
+				c.queue.Report(&Report{
+					JobID:  p.job.ID,
+					Worker: name,
+					Done:   true,
+					Error:  fmt.Sprintf("worker %s stopped responding", name),
+				})
+			}
+			if orphaned == 0 {
+				continue
+			}
+			duration := s.job.Duration
+			if duration > 0 {
+				duration -= now.Sub(s.started)
+				if duration <= 0 {
+					continue
+				}
+			}
+			c.assign(s, orphaned, duration, live)
+		}
+	}
+	return gone
+}
+
+// Watch calls Rebalance every interval, forever
+func (c *Coordinator) Watch(interval time.Duration) {
+	for range time.Tick(interval) {
+		c.Rebalance()
+	}
+}
+
+// expire forgets the splits whose parts the queue has forgotten. The caller
+// holds the lock.
+func (c *Coordinator) expire() {
+	c.queue.prune()
+	for id, s := range c.splits {
+		forgotten := len(s.parts) > 0
+		for _, p := range s.parts {
+			if c.queue.has(p.job.ID) {
+				forgotten = false
+				break
+			}
+		}
+		if !forgotten {
+			continue
+		}
+		for _, p := range s.parts {
+			delete(c.partOf, p.job.ID)
+		}
+		delete(c.splits, id)
+	}
+}
+
+// assign queues new parts of the split that add up to the given concurrency,
+// one per worker. With no workers there's a single part anyone can take.
+func (c *Coordinator) assign(s *split, concurrency int, duration time.Duration, workers []string) error {
+	if len(workers) == 0 {
+		workers = []string{""}
+	}
+	for i, sessions := range divide(concurrency, len(workers)) {
+		if sessions == 0 {
+			continue
+		}
+		job := *s.job
+		job.ID = s.job.ID + "-" + strconv.Itoa(len(s.parts)+1)
+		job.Parent = s.job.ID
+		job.Worker = workers[i]
+		job.Concurrency = sessions
+		job.Duration = duration
+		if err := c.queue.Push(&job); err != nil {
+			return err
+		}
+		s.parts = append(s.parts, &part{job: &job})
+		c.partOf[job.ID] = s
+	}
+	return nil
+}
+
+// live lists, in order, the workers heard from within the timeout
+func (c *Coordinator) live(now time.Time) []string {
+	names := []string{}
+	for name, seen := range c.workers {
+		if now.Sub(seen) <= c.Timeout {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (s *split) part(jobID string) *part {
+	for _, p := range s.parts {
+		if p.job.ID == jobID {
+			return p
+		}
+	}
+	return nil
+}
+
+// divide splits total into n shares that differ by at most one
+func divide(total, n int) []int {
+	shares := make([]int, n)
+	for i := range shares {
+		shares[i] = total / n
+		if i < total%n {
+			shares[i]++
+		}
+	}
+	return shares
+}
@@ -0,0 +1,282 @@
+package queue
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/JackDanger/traffic/runner"
+)
+
+func TestCoordinatorSplitsConcurrencyAcrossWorkers(t *testing.T) {
+	c := NewCoordinator(time.Minute)
+	for _, name := range []string{"a", "b", "c"} {
+		c.Heartbeat(name)
+	}
+	job := &Job{ArchiveID: 12, Concurrency: 10, Duration: time.Minute}
+	if err := c.Push(job); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, expected := range map[string]int{"a": 4, "b": 3, "c": 3} {
+		part, err := c.Pop(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if part == nil {
+			t.Fatalf("Expected worker %s to get a part of the job", name)
+		}
+		if part.Concurrency != expected {
+			t.Errorf("Expected worker %s to run %d sessions, got: %d", name, expected, part.Concurrency)
+		}
+		if part.Parent != job.ID || part.ArchiveID != 12 || part.Duration != time.Minute {
+			t.Errorf("Expected the part to be a copy of the job, got: %#v", part)
+		}
+		if extra, _ := c.Pop(name); extra != nil {
+			t.Errorf("Expected worker %s to get only one part, got another: %#v", name, extra)
+		}
+	}
+
+	workers := c.Workers()
+	if len(workers) != 3 || workers[0].Name != "a" || workers[0].Sessions != 4 {
+		t.Errorf("Expected three workers with a running 4 sessions, got: %#v", workers)
+	}
+}
+
+func TestCoordinatorMergesReports(t *testing.T) {
+	c := NewCoordinator(time.Minute)
+	c.Heartbeat("a")
+	c.Heartbeat("b")
+	job := &Job{Concurrency: 2}
+	if err := c.Push(job); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"a", "b"} {
+		part, _ := c.Pop(name)
+		err := c.Report(&Report{
+			JobID:   part.ID,
+			Worker:  name,
+			Results: []runner.Result{{Status: 200}, {Status: 404}},
+			Done:    name == "a",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	status, err := c.Status(job.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Summary.Requests != 4 {
+		t.Errorf("Expected results from both workers to be merged, got: %d requests", status.Summary.Requests)
+	}
+	if status.Summary.StatusCodes[404] != 2 {
+		t.Errorf("Expected 2 404s, got: %#v", status.Summary.StatusCodes)
+	}
+	if len(status.Parts) != 2 || status.Parts[0].Summary.Requests != 2 {
+		t.Errorf("Expected each worker's part to be listed, got: %#v", status.Parts)
+	}
+	if status.Done {
+		t.Errorf("Expected the job not to be done while b is still running")
+	}
+
+	part, _ := c.Status(job.ID + "-2")
+	c.Report(&Report{JobID: part.Job.ID, Worker: "b", Done: true})
+	status, _ = c.Status(job.ID)
+	if !status.Done {
+		t.Errorf("Expected the job to be done once every part is")
+	}
+}
+
+func TestCoordinatorRebalancesWhenAWorkerDisappears(t *testing.T) {
+	c := NewCoordinator(50 * time.Millisecond)
+	c.Heartbeat("a")
+	c.Heartbeat("b")
+	job := &Job{Concurrency: 4, Duration: time.Hour}
+	if err := c.Push(job); err != nil {
+		t.Fatal(err)
+	}
+	abandoned, _ := c.Pop("a")
+	first, _ := c.Pop("b")
+
+	time.Sleep(100 * time.Millisecond)
+	c.Heartbeat("b")
+	gone := c.Rebalance()
+	if !reflect.DeepEqual(gone, []string{"a"}) {
+		t.Fatalf("Expected worker a to be gone, got: %v", gone)
+	}
+
+	second, _ := c.Pop("b")
+	if second == nil {
+		t.Fatalf("Expected a's sessions to be handed to b")
+	}
+	if second.Concurrency != 2 {
+		t.Errorf("Expected b to pick up a's 2 sessions, got: %d", second.Concurrency)
+	}
+	if second.Duration <= 0 || second.Duration >= time.Hour {
+		t.Errorf("Expected the reassigned sessions to run for the rest of the hour, got: %s", second.Duration)
+	}
+
+	// If a comes back its results are no longer wanted
+	err := c.Report(&Report{JobID: abandoned.ID, Worker: "a", Results: []runner.Result{{Status: 200}}, Done: true})
+	if err != ErrAbandoned {
+		t.Errorf("Expected a to be told its part was abandoned, got: %v", err)
+	}
+	for _, part := range []*Job{first, second} {
+		c.Report(&Report{JobID: part.ID, Worker: "b", Results: []runner.Result{{Status: 200}}, Done: true})
+	}
+
+	status, err := c.Status(job.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !status.Done {
+		t.Errorf("Expected the job to be done once b finished everything")
+	}
+	if status.Summary.Requests != 2 {
+		t.Errorf("Expected only b's results to count, got: %d requests", status.Summary.Requests)
+	}
+	if status.Parts[0].Error == "" {
+		t.Errorf("Expected a's part to say why it was abandoned")
+	}
+}
+
+func TestCoordinatorWithoutWorkers(t *testing.T) {
+	c := NewCoordinator(time.Minute)
+	job := &Job{Concurrency: 5}
+	if err := c.Push(job); err != nil {
+		t.Fatal(err)
+	}
+
+	part, _ := c.Pop("latecomer")
+	if part == nil || part.Concurrency != 5 {
+		t.Errorf("Expected the first worker to show up to get the whole job, got: %#v", part)
+	}
+}
+
+func TestCoordinatorRebalancesPartsTakenWithoutWorkers(t *testing.T) {
+	c := NewCoordinator(50 * time.Millisecond)
+	job := &Job{Concurrency: 5, Duration: time.Hour}
+	if err := c.Push(job); err != nil {
+		t.Fatal(err)
+	}
+	first, _ := c.Pop("latecomer")
+	if first == nil || first.Worker != "latecomer" {
+		t.Fatalf("Expected the part to belong to the worker that took it, got: %#v", first)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	c.Heartbeat("b")
+	if gone := c.Rebalance(); !reflect.DeepEqual(gone, []string{"latecomer"}) {
+		t.Fatalf("Expected the latecomer to be gone, got: %v", gone)
+	}
+	second, _ := c.Pop("b")
+	if second == nil || second.Concurrency != 5 {
+		t.Fatalf("Expected the latecomer's sessions to be handed to b, got: %#v", second)
+	}
+
+	c.Report(&Report{JobID: second.ID, Worker: "b", Done: true})
+	if status, _ := c.Status(job.ID); !status.Done {
+		t.Errorf("Expected the job to be done once b finished it")
+	}
+}
+
+func TestCoordinatorForgetsFinishedJobs(t *testing.T) {
+	c := NewCoordinator(time.Minute)
+	c.queue.Retention = 50 * time.Millisecond
+	c.Heartbeat("a")
+	c.Heartbeat("b")
+	job := &Job{Concurrency: 2}
+	if err := c.Push(job); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"a", "b"} {
+		part, _ := c.Pop(name)
+		c.Report(&Report{JobID: part.ID, Worker: name, Done: true})
+	}
+	if status, err := c.Status(job.ID); err != nil || !status.Done {
+		t.Errorf("Expected a job that just finished to be remembered, got: %#v (%v)", status, err)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	if _, err := c.Status(job.ID); err == nil {
+		t.Errorf("Expected the finished job to be forgotten after the retention window")
+	}
+	c.m.Lock()
+	defer c.m.Unlock()
+	if len(c.splits) != 0 || len(c.partOf) != 0 {
+		t.Errorf("Expected nothing to be left of the job, got: %d splits and %d parts", len(c.splits), len(c.partOf))
+	}
+}
+
+func TestCoordinatorStatusOutlivesAbandonedParts(t *testing.T) {
+	c := NewCoordinator(50 * time.Millisecond)
+	c.queue.Retention = 50 * time.Millisecond
+	c.Heartbeat("a")
+	c.Heartbeat("b")
+	job := &Job{Concurrency: 4, Duration: time.Hour}
+	if err := c.Push(job); err != nil {
+		t.Fatal(err)
+	}
+	c.Pop("a")
+	c.Pop("b")
+
+	time.Sleep(100 * time.Millisecond)
+	c.Heartbeat("b")
+	c.Rebalance()
+	c.Pop("b")
+
+	// a's part has been over for longer than the retention, b's are running
+	time.Sleep(100 * time.Millisecond)
+	status, err := c.Status(job.ID)
+	if err != nil {
+		t.Fatalf("Expected the job to still be found while b runs it, got: %v", err)
+	}
+	if status.Done || len(status.Parts) != 2 {
+		t.Errorf("Expected b's two running parts, got: %#v", status)
+	}
+}
+
+func TestCoordinatorOverHTTP(t *testing.T) {
+	c := NewCoordinator(time.Minute)
+	server := httptest.NewServer(NewHandler(c))
+	defer server.Close()
+	client := NewClient(server.URL)
+
+	if err := client.Heartbeat("remote"); err != nil {
+		t.Fatal(err)
+	}
+	if workers := c.Workers(); len(workers) != 1 || workers[0].Name != "remote" {
+		t.Errorf("Expected the heartbeat to register the worker, got: %#v", workers)
+	}
+
+	job := &Job{Concurrency: 1}
+	if err := client.Push(job); err != nil {
+		t.Fatal(err)
+	}
+	part, err := client.Pop("remote")
+	if err != nil || part == nil {
+		t.Fatalf("Expected a part of the job, got: %#v (%v)", part, err)
+	}
+	c.m.Lock()
+	c.partOf[part.ID].part(part.ID).abandoned = true
+	c.m.Unlock()
+	if err := client.Report(&Report{JobID: part.ID, Worker: "remote"}); err != ErrAbandoned {
+		t.Errorf("Expected the client to be told its part was abandoned, got: %v", err)
+	}
+}
+
+func TestDivide(t *testing.T) {
+	if shares := divide(500, 4); !reflect.DeepEqual(shares, []int{125, 125, 125, 125}) {
+		t.Errorf("Expected 500 to be split evenly, got: %v", shares)
+	}
+	if shares := divide(5, 3); !reflect.DeepEqual(shares, []int{2, 2, 1}) {
+		t.Errorf("Expected the remainder to go to the first workers, got: %v", shares)
+	}
+	if shares := divide(1, 3); !reflect.DeepEqual(shares, []int{1, 0, 0}) {
+		t.Errorf("Expected workers to get nothing when there's not enough to go around, got: %v", shares)
+	}
+}
@@ -0,0 +1,221 @@
+package queue
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// NewServer returns an http.Server that exposes the queue to workers at the
+// given address. Calling ListenAndServe on it is a blocking call.
+func NewServer(address string, q Queue) *http.Server {
+	return &http.Server{
+		Addr:    address,
+		Handler: NewHandler(q),
+	}
+}
+
+// NewHandler exposes a Queue over HTTP:
+//
+//   POST /jobs                 enqueues the Job in the body
+//   GET  /jobs/next?worker=... pops the next Job (204 when there isn't one)
+//   GET  /jobs/{id}            the job's Status
+//   POST /jobs/{id}/reports    records the Report in the body (410 once it's abandoned)
+//   POST /workers/{name}       a heartbeat from the named worker
+//   GET  /workers              the live workers (only when q is a Coordinator)
+//
+func NewHandler(q Queue) http.Handler {
+	r := mux.NewRouter()
+
+	r.HandleFunc("/jobs", func(w http.ResponseWriter, r *http.Request) {
+		job := &Job{}
+		if err := readJSON(r, job); err != nil {
+			fail(w, http.StatusBadRequest, err)
+			return
+		}
+		if err := q.Push(job); err != nil {
+			fail(w, http.StatusInternalServerError, err)
+			return
+		}
+		writeJSON(w, job)
+	}).Methods("POST")
+
+	r.HandleFunc("/jobs/next", func(w http.ResponseWriter, r *http.Request) {
+		job, err := q.Pop(r.URL.Query().Get("worker"))
+		if err != nil {
+			fail(w, http.StatusInternalServerError, err)
+			return
+		}
+		if job == nil {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		writeJSON(w, job)
+	}).Methods("GET")
+
+	r.HandleFunc("/jobs/{id}", func(w http.ResponseWriter, r *http.Request) {
+		status, err := q.Status(mux.Vars(r)["id"])
+		if err != nil {
+			fail(w, http.StatusNotFound, err)
+			return
+		}
+		writeJSON(w, status)
+	}).Methods("GET")
+
+	r.HandleFunc("/jobs/{id}/reports", func(w http.ResponseWriter, r *http.Request) {
+		report := &Report{}
+		if err := readJSON(r, report); err != nil {
+			fail(w, http.StatusBadRequest, err)
+			return
+		}
+		report.JobID = mux.Vars(r)["id"]
+		if err := q.Report(report); err == ErrAbandoned {
+			fail(w, http.StatusGone, err)
+			return
+		} else if err != nil {
+			fail(w, http.StatusNotFound, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}).Methods("POST")
+
+	r.HandleFunc("/workers/{name}", func(w http.ResponseWriter, r *http.Request) {
+		if err := q.Heartbeat(mux.Vars(r)["name"]); err != nil {
+			fail(w, http.StatusInternalServerError, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}).Methods("POST")
+
+	if coordinator, ok := q.(*Coordinator); ok {
+		r.HandleFunc("/workers", func(w http.ResponseWriter, r *http.Request) {
+			writeJSON(w, coordinator.Workers())
+		}).Methods("GET")
+	}
+
+	return r
+}
+
+// Client is a Queue that talks to the HTTP API served by NewHandler. It's
+// what workers use to reach the queue inside `traffic server`.
+type Client struct {
+	baseURL string
+	http    http.Client
+}
+
+var _ Queue = &Client{}
+
+// NewClient connects to the queue at the given address, e.g. "localhost:7000"
+// or "http://queue.internal:7000"
+func NewClient(address string) *Client {
+	if !strings.Contains(address, "://") {
+		address = "http://" + address
+	}
+	return &Client{
+		baseURL: strings.TrimRight(address, "/"),
+		http:    http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// Push enqueues a job
+func (c *Client) Push(job *Job) error {
+	return c.do("POST", "/jobs", job, job)
+}
+
+// Pop asks for the next job for this worker
+func (c *Client) Pop(worker string) (*Job, error) {
+	job := &Job{}
+	err := c.do("GET", "/jobs/next?worker="+url.QueryEscape(worker), nil, job)
+	if err != nil || job.ID == "" {
+		return nil, err
+	}
+	return job, nil
+}
+
+// Report sends a batch of results
+func (c *Client) Report(report *Report) error {
+	return c.do("POST", "/jobs/"+url.PathEscape(report.JobID)+"/reports", report, nil)
+}
+
+// Status fetches the progress of a job
+func (c *Client) Status(jobID string) (*Status, error) {
+	status := &Status{}
+	if err := c.do("GET", "/jobs/"+url.PathEscape(jobID), nil, status); err != nil {
+		return nil, err
+	}
+	return status, nil
+}
+
+// Heartbeat tells the queue this worker is still alive
+func (c *Client) Heartbeat(worker string) error {
+	return c.do("POST", "/workers/"+url.PathEscape(worker), nil, nil)
+}
+
+// do sends `in` as JSON and decodes the JSON response into `out`. Either may
+// be nil.
+func (c *Client) do(method, path string, in, out interface{}) error {
+	var body []byte
+	if in != nil {
+		var err error
+		if body, err = json.Marshal(in); err != nil {
+			return err
+		}
+	}
+	req, err := http.NewRequest(method, c.baseURL+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	content, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode == http.StatusGone {
+		return ErrAbandoned
+	}
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("queue responded to %s %s with %s: %s", method, path, resp.Status, content)
+	}
+	if out == nil || resp.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	return json.Unmarshal(content, out)
+}
+
+func readJSON(r *http.Request, v interface{}) error {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(body, v)
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	content, err := json.Marshal(v)
+	if err != nil {
+		fail(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(content)
+}
+
+func fail(w http.ResponseWriter, status int, err error) {
+	w.WriteHeader(status)
+	w.Write([]byte(err.Error()))
+}
@@ -0,0 +1,160 @@
+package queue
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/JackDanger/traffic/runner"
+	"github.com/JackDanger/traffic/util"
+)
+
+// MemoryQueue is a Queue that keeps everything in this process. It's what
+// `traffic server` uses so that workers can be run with no outside services.
+// Jobs that are done are forgotten once they've been done for longer than
+// Retention.
+type MemoryQueue struct {
+	Retention time.Duration
+
+	m       sync.Mutex
+	pending []*Job
+	jobs    map[string]*memoryJob
+}
+
+type memoryJob struct {
+	job      *Job
+	worker   string
+	done     bool
+	finished time.Time // when it was done
+	err      string
+	stats    *runner.Stats
+}
+
+// DefaultRetention is how long a MemoryQueue remembers jobs that are done
+const DefaultRetention = time.Hour
+
+var _ Queue = &MemoryQueue{}
+
+// NewMemoryQueue returns an empty MemoryQueue
+func NewMemoryQueue() *MemoryQueue {
+	return &MemoryQueue{Retention: DefaultRetention, jobs: map[string]*memoryJob{}}
+}
+
+// Push enqueues a job at the back of the line
+func (q *MemoryQueue) Push(job *Job) error {
+	q.m.Lock()
+	defer q.m.Unlock()
+
+	q.expire(time.Now())
+	if job.ID == "" {
+		job.ID = util.UUID()
+	}
+	if _, ok := q.jobs[job.ID]; ok {
+		return fmt.Errorf("job %s is already queued", job.ID)
+	}
+	q.pending = append(q.pending, job)
+	q.jobs[job.ID] = &memoryJob{job: job, stats: runner.NewStats()}
+	return nil
+}
+
+// Pop hands the oldest pending job to the worker, skipping any that are
+// meant for other workers
+func (q *MemoryQueue) Pop(worker string) (*Job, error) {
+	q.m.Lock()
+	defer q.m.Unlock()
+
+	for i, job := range q.pending {
+		if job.Worker != "" && job.Worker != worker {
+			continue
+		}
+		q.pending = append(q.pending[:i:i], q.pending[i+1:]...)
+		q.jobs[job.ID].worker = worker
+		return job, nil
+	}
+	return nil, nil
+}
+
+// Report adds the worker's results to the job's stats
+func (q *MemoryQueue) Report(report *Report) error {
+	q.m.Lock()
+	defer q.m.Unlock()
+
+	record, ok := q.jobs[report.JobID]
+	if !ok {
+		return fmt.Errorf("no such job: %s", report.JobID)
+	}
+	for _, result := range report.Results {
+		record.stats.Add(result)
+	}
+	if report.Error != "" {
+		record.err = report.Error
+	}
+	if report.Done && !record.done {
+		record.done = true
+		record.finished = time.Now()
+	}
+	return nil
+}
+
+// prune forgets the jobs that have been done for longer than Retention
+func (q *MemoryQueue) prune() {
+	q.m.Lock()
+	defer q.m.Unlock()
+	q.expire(time.Now())
+}
+
+// has says whether the queue still remembers the job
+func (q *MemoryQueue) has(jobID string) bool {
+	q.m.Lock()
+	defer q.m.Unlock()
+	_, ok := q.jobs[jobID]
+	return ok
+}
+
+// expire forgets the jobs that have been done for longer than Retention. The
+// caller holds the lock.
+func (q *MemoryQueue) expire(now time.Time) {
+	for id, record := range q.jobs {
+		if record.done && now.Sub(record.finished) > q.Retention {
+			delete(q.jobs, id)
+		}
+	}
+}
+
+// Heartbeat does nothing, the MemoryQueue hands jobs to any worker that asks
+// and doesn't keep track of them otherwise
+func (q *MemoryQueue) Heartbeat(worker string) error {
+	return nil
+}
+
+// cancel takes a job out of line if nobody has picked it up yet
+func (q *MemoryQueue) cancel(jobID string) {
+	q.m.Lock()
+	defer q.m.Unlock()
+
+	for i, job := range q.pending {
+		if job.ID == jobID {
+			q.pending = append(q.pending[:i:i], q.pending[i+1:]...)
+			return
+		}
+	}
+}
+
+// Status summarizes the results reported for a job so far
+func (q *MemoryQueue) Status(jobID string) (*Status, error) {
+	q.m.Lock()
+	defer q.m.Unlock()
+
+	q.expire(time.Now())
+	record, ok := q.jobs[jobID]
+	if !ok {
+		return nil, fmt.Errorf("no such job: %s", jobID)
+	}
+	return &Status{
+		Job:     record.job,
+		Worker:  record.worker,
+		Done:    record.done,
+		Error:   record.err,
+		Summary: record.stats.Summary(),
+	}, nil
+}
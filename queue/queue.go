@@ -0,0 +1,78 @@
+// The queue package hands replay jobs out to workers and collects the
+// results they stream back. `traffic server` runs an in-memory queue behind a
+// small HTTP API and `traffic worker` talks to it with a Client, but anything
+// that implements Queue can be plugged in instead.
+package queue
+
+import (
+	"time"
+
+	"github.com/JackDanger/traffic/persistence"
+	"github.com/JackDanger/traffic/runner"
+	"github.com/JackDanger/traffic/util"
+)
+
+// Queue is a store of Jobs waiting for a worker and the Reports that workers
+// send back while they perform them.
+type Queue interface {
+	// Push enqueues a job, assigning it an ID if it doesn't have one
+	Push(*Job) error
+	// Pop hands the next job to the named worker. It returns nil (and no
+	// error) when there's nothing to do.
+	Pop(worker string) (*Job, error)
+	// Report records a batch of results from a worker
+	Report(*Report) error
+	// Status describes how far along a job is
+	Status(jobID string) (*Status, error)
+	// Heartbeat tells the queue the named worker is still alive
+	Heartbeat(worker string) error
+}
+
+// Job is everything a worker needs to replay an archive. The HAR and its
+// transforms travel with the job so that workers never need a database.
+type Job struct {
+	ID          string                  `json:"id"`
+	ArchiveID   int64                   `json:"archive_id"`
+	Source      string                  `json:"source"` // the archive's HAR as JSON
+	Target      string                  `json:"target"` // see transforms.NewTargetTransform
+	Transforms  []persistence.Transform `json:"transforms"`
+	Velocity    float64                 `json:"velocity"`
+	Concurrency int                     `json:"concurrency"`
+	Duration    time.Duration           `json:"duration"`         // keep replaying for this long, or just once if 0
+	Worker      string                  `json:"worker,omitempty"` // only this worker may take the job, if set
+	Parent      string                  `json:"parent,omitempty"` // the job this one is a part of, see Coordinator
+}
+
+// NewJob prepares a stored archive and its transforms to be sent to a worker
+func NewJob(archive *persistence.Archive, transforms []persistence.Transform, velocity float64, concurrency int, duration time.Duration) *Job {
+	return &Job{
+		ID:          util.UUID(),
+		ArchiveID:   archive.ID,
+		Source:      archive.Source,
+		Target:      archive.Target,
+		Transforms:  transforms,
+		Velocity:    velocity,
+		Concurrency: concurrency,
+		Duration:    duration,
+	}
+}
+
+// Report is a batch of results streamed back from a worker. The last report
+// for a job is marked Done.
+type Report struct {
+	JobID   string          `json:"job_id"`
+	Worker  string          `json:"worker"`
+	Results []runner.Result `json:"results"`
+	Done    bool            `json:"done"`
+	Error   string          `json:"error,omitempty"` // why the worker gave up, if it did
+}
+
+// Status is the progress of a single job
+type Status struct {
+	Job     *Job           `json:"job"`
+	Worker  string         `json:"worker"` // empty until a worker picks the job up
+	Done    bool           `json:"done"`
+	Error   string         `json:"error,omitempty"`
+	Summary runner.Summary `json:"summary"`
+	Parts   []*Status      `json:"parts,omitempty"` // how each worker is doing, for jobs split by a Coordinator
+}
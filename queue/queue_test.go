@@ -0,0 +1,135 @@
+package queue
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/JackDanger/traffic/runner"
+)
+
+func TestMemoryQueue(t *testing.T) {
+	testQueue(t, NewMemoryQueue())
+}
+
+func TestMemoryQueueForgetsFinishedJobs(t *testing.T) {
+	q := NewMemoryQueue()
+	q.Retention = 50 * time.Millisecond
+	finished, running := &Job{}, &Job{}
+	for _, job := range []*Job{finished, running} {
+		if err := q.Push(job); err != nil {
+			t.Fatal(err)
+		}
+		q.Pop("worker-1")
+	}
+	q.Report(&Report{JobID: finished.ID, Worker: "worker-1", Done: true})
+	if _, err := q.Status(finished.ID); err != nil {
+		t.Errorf("Expected a job that just finished to be remembered, got: %v", err)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	if _, err := q.Status(finished.ID); err == nil {
+		t.Errorf("Expected the finished job to be forgotten after the retention window")
+	}
+	if _, err := q.Status(running.ID); err != nil {
+		t.Errorf("Expected a job that's still running to be remembered, got: %v", err)
+	}
+}
+
+func TestClient(t *testing.T) {
+	server := httptest.NewServer(NewHandler(NewMemoryQueue()))
+	defer server.Close()
+
+	testQueue(t, NewClient(server.URL))
+}
+
+func TestClientAddsScheme(t *testing.T) {
+	client := NewClient("localhost:7000/")
+	if client.baseURL != "http://localhost:7000" {
+		t.Errorf("Expected http://localhost:7000, got: %s", client.baseURL)
+	}
+}
+
+// testQueue runs the same scenario against any Queue implementation
+func testQueue(t *testing.T, q Queue) {
+	job, err := q.Pop("worker-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job != nil {
+		t.Fatalf("Expected no job from an empty queue, got: %#v", job)
+	}
+
+	first := &Job{ArchiveID: 1, Velocity: 2.0, Concurrency: 3, Duration: time.Minute}
+	second := &Job{ArchiveID: 2}
+	if err := q.Push(first); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.Push(second); err != nil {
+		t.Fatal(err)
+	}
+	if first.ID == "" || second.ID == "" || first.ID == second.ID {
+		t.Fatalf("Expected jobs to be given distinct IDs, got: %q and %q", first.ID, second.ID)
+	}
+
+	job, err = q.Pop("worker-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job == nil || job.ID != first.ID {
+		t.Fatalf("Expected the first job back, got: %#v", job)
+	}
+	if job.Velocity != 2.0 || job.Concurrency != 3 || job.Duration != time.Minute {
+		t.Errorf("Expected the job's parameters to survive, got: %#v", job)
+	}
+
+	status, err := q.Status(first.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Worker != "worker-1" {
+		t.Errorf("Expected the job to be assigned to worker-1, got: %q", status.Worker)
+	}
+	if status.Done {
+		t.Errorf("Expected the job not to be done yet")
+	}
+
+	err = q.Report(&Report{
+		JobID:   first.ID,
+		Worker:  "worker-1",
+		Results: []runner.Result{{Status: 200, Total: time.Millisecond}, {Status: 500, Total: time.Millisecond}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = q.Report(&Report{
+		JobID:   first.ID,
+		Worker:  "worker-1",
+		Results: []runner.Result{{Status: 200, Total: time.Millisecond}},
+		Done:    true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	status, err = q.Status(first.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !status.Done {
+		t.Errorf("Expected the job to be done")
+	}
+	if status.Summary.Requests != 3 {
+		t.Errorf("Expected 3 requests, got: %d", status.Summary.Requests)
+	}
+	if status.Summary.Errors != 1 {
+		t.Errorf("Expected 1 error, got: %d", status.Summary.Errors)
+	}
+
+	if err := q.Report(&Report{JobID: "nope"}); err == nil {
+		t.Errorf("Expected reporting on an unknown job to fail")
+	}
+	if _, err := q.Status("nope"); err == nil {
+		t.Errorf("Expected the status of an unknown job to fail")
+	}
+}
@@ -3,10 +3,17 @@ package runner
 import (
 	"bytes"
 	"compress/gzip"
+	"crypto/tls"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"mime/multipart"
 	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/JackDanger/traffic/model"
 	"github.com/JackDanger/traffic/util"
@@ -15,12 +22,16 @@ import (
 // Executor is anything that can perform HTTP requests (it's an
 // interface so we can mock it in tests)
 type Executor interface {
-	Get(model.Request) (*model.Response, error)
-	Post(model.Request) (*model.Response, error)
-	Put(model.Request) (*model.Response, error)
-	Delete(model.Request) (*model.Response, error)
-	Head(model.Request) (*model.Response, error)
-	Patch(model.Request) (*model.Response, error)
+	// Do performs the request using whatever HTTP verb it was recorded with
+	Do(model.Request) (*model.Response, error)
+}
+
+// CookieJarExecutor is an Executor that can keep its cookies in a jar owned
+// by the HarRunner driving it, so Set-Cookie headers from one response are
+// sent along with every following request.
+type CookieJarExecutor interface {
+	Executor
+	SetCookieJar(http.CookieJar)
 }
 
 // HTTPExecutor has methods that accept a request from a HAR file and
@@ -33,56 +44,135 @@ type HTTPExecutor struct {
 	lastRequest *http.Request // only for testing
 }
 
-// Get performs an HTTP POST
-func (e *HTTPExecutor) Get(r model.Request) (*model.Response, error) {
-	req, err := http.NewRequest("GET", r.URL, nil)
+// Do builds an http.Request for any verb (GET, OPTIONS, PROPFIND, or anything
+// else the HAR recorded) out of the model.Request, sending the PostData (if
+// any) as the body, and performs it.
+func (e *HTTPExecutor) Do(r model.Request) (*model.Response, error) {
+	method := r.Method
+	if method == "" {
+		method = "GET"
+	}
+	body, contentType, err := requestBody(r.PostData)
+	if err != nil {
+		e.handleError(err)
+		return &model.Response{}, err
+	}
+	req, err := http.NewRequest(method, requestURL(r), body)
 	if err != nil {
 		e.handleError(err)
 		return &model.Response{}, err
 	}
 
 	e.fromModelRequest(req, &r)
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
 
-	return e.toModelResponse(e.client.Do(req)), nil
+	t := &tracer{}
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), t.clientTrace()))
+	t.start = time.Now()
+	t.trace.BytesOut = req.ContentLength
+
+	h, err := e.client.Do(req)
+	if err != nil {
+		e.handleError(err)
+		return &model.Response{Trace: t.finish()}, err
+	}
+	return e.toModelResponse(h, t), nil
 }
 
-// Post performs an HTTP POST
-func (e *HTTPExecutor) Post(r model.Request) (*model.Response, error) {
-	var text string
-	if r.PostData != nil {
-		text = r.PostData.Text
-	} else {
-		text = ""
+// requestURL rebuilds the query string of the request's URL out of the HAR's
+// queryString list so that any transforms applied to that list take effect.
+// A request with an empty list is sent with its URL untouched.
+func requestURL(r model.Request) string {
+	if len(r.QueryString) == 0 {
+		return r.URL
 	}
-	req, err := http.NewRequest("POST", r.URL, bytes.NewBufferString(text))
+	u, err := url.Parse(r.URL)
 	if err != nil {
-		e.handleError(err)
-		return &model.Response{}, err
+		// Let http.NewRequest report on the broken URL
+		return r.URL
 	}
+	u.RawQuery = encodePairs(r.QueryString)
+	return u.String()
+}
 
-	e.fromModelRequest(req, &r)
+// requestBody produces the body to send for the given PostData. The recorded
+// text is used as-is, but some HARs only record a form's params and in that
+// case they're encoded according to the mime type. If that encoding means
+// the Content-Type header has to change (multipart forms get a new boundary)
+// that header value is returned too.
+func requestBody(postData *model.PostData) (io.Reader, string, error) {
+	if postData == nil || postData.Text != "" || len(postData.Params) == 0 {
+		var text string
+		if postData != nil {
+			text = postData.Text
+		}
+		return bytes.NewBufferString(text), "", nil
+	}
+
+	if strings.HasPrefix(postData.MimeType, "multipart/form-data") {
+		body := &bytes.Buffer{}
+		writer := multipart.NewWriter(body)
+		for _, param := range postData.Params {
+			if err := writer.WriteField(*param.Key, *param.Value); err != nil {
+				return nil, "", err
+			}
+		}
+		if err := writer.Close(); err != nil {
+			return nil, "", err
+		}
+		return body, writer.FormDataContentType(), nil
+	}
 
-	return e.toModelResponse(e.client.Do(req)), nil
+	contentType := ""
+	if postData.MimeType == "" {
+		contentType = "application/x-www-form-urlencoded"
+	}
+	return bytes.NewBufferString(encodePairs(postData.Params)), contentType, nil
 }
 
-// Put performs an HTTP PUT
-func (e *HTTPExecutor) Put(r model.Request) (*model.Response, error) {
-	return &model.Response{}, nil
+// encodePairs url-encodes the pairs in the order they were recorded (unlike
+// url.Values, which sorts them). Some HAR exporters record the values already
+// escaped and some don't so only the characters that can't be sent as they
+// are get escaped.
+func encodePairs(pairs []model.SingleItemMap) string {
+	encoded := []string{}
+	for _, pair := range pairs {
+		encoded = append(encoded, escape(*pair.Key)+"="+escape(*pair.Value))
+	}
+	return strings.Join(encoded, "&")
 }
 
-// Delete performs an HTTP DELETE
-func (e *HTTPExecutor) Delete(r model.Request) (*model.Response, error) {
-	return &model.Response{}, nil
+// escape leaves letters, digits, "-._~", "+" and anything that's already
+// escaped (like %2B) as they were recorded and escapes everything else
+func escape(s string) string {
+	escaped := strings.Builder{}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '%' && i+2 < len(s) && isHex(s[i+1]) && isHex(s[i+2]):
+			escaped.WriteByte(c)
+		case c == '+' || c == '-' || c == '.' || c == '_' || c == '~' ||
+			c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z':
+			escaped.WriteByte(c)
+		case c == ' ':
+			escaped.WriteByte('+')
+		default:
+			fmt.Fprintf(&escaped, "%%%02X", c)
+		}
+	}
+	return escaped.String()
 }
 
-// Head is the equivalent of `curl -I`
-func (e *HTTPExecutor) Head(r model.Request) (*model.Response, error) {
-	return &model.Response{}, nil
+func isHex(c byte) bool {
+	return c >= '0' && c <= '9' || c >= 'a' && c <= 'f' || c >= 'A' && c <= 'F'
 }
 
-// Patch is an HTTP verb we'll rarely see
-func (e *HTTPExecutor) Patch(r model.Request) (*model.Response, error) {
-	return &model.Response{}, nil
+// SetCookieJar makes every subsequent request send (and update) the cookies
+// in the given jar instead of the ones recorded in the HAR.
+func (e *HTTPExecutor) SetCookieJar(jar http.CookieJar) {
+	e.client.Jar = jar
 }
 
 // NewHTTPExecutor returns an object that can perform live HTTP requests
@@ -93,11 +183,8 @@ func NewHTTPExecutor(name string, logDevice io.Writer) Executor {
 	}
 }
 
-func (e *HTTPExecutor) toModelResponse(h *http.Response, err error) *model.Response {
-	if err != nil {
-		e.handleError(err)
-		return &model.Response{}
-	}
+func (e *HTTPExecutor) toModelResponse(h *http.Response, t *tracer) *model.Response {
+	defer h.Body.Close()
 
 	headers := []model.SingleItemMap{}
 	for key, values := range h.Header {
@@ -114,26 +201,46 @@ func (e *HTTPExecutor) toModelResponse(h *http.Response, err error) *model.Respo
 		}
 	}
 
+	cookies := []model.SingleItemMap{}
+	for _, cookie := range h.Cookies() {
+		cookies = append(cookies, model.SingleItemMap{
+			Key:   util.StringPtr(cookie.Name),
+			Value: util.StringPtr(cookie.Value),
+		})
+	}
+
 	e.log(h.Status)
 
+	// Count the bytes as they come off the wire, before any decompression
+	counter := &countingReader{ReadCloser: h.Body}
+	h.Body = counter
 	body := e.readBody(h)
 	e.log("body length: ", len(body))
+	t.trace.BytesIn = counter.n
 
-	return &model.Response{
+	response := &model.Response{
 		HTTPVersion: h.Proto,
 		Status:      h.StatusCode,
 		StatusText:  h.Status,
 		Headers:     headers,
+		Cookies:     cookies,
 		ContentBody: func(s string) *string { return &s }(string(body)),
+		RedirectURL: h.Header.Get("Location"),
+		HeadersSize: -1, // net/http doesn't expose the raw header block
+		BodySize:    int(h.ContentLength),
+		Trace:       t.finish(),
 	}
+	response.Content.Size = len(body)
+	response.Content.MimeType = h.Header.Get("Content-Type")
+	return response
 }
 
 func (e *HTTPExecutor) handleError(err error) {
 	e.log("Executor error: ", err.Error())
 }
 
-// Reads the headers from the model.Request and applies them to the
-// http.Request. Adds a Content-Type header if one is missing.
+// Reads the headers and cookies from the model.Request and applies them to
+// the http.Request. Adds a Content-Type header if one is missing.
 func (e *HTTPExecutor) fromModelRequest(req *http.Request, modelRequest *model.Request) {
 	e.log(req.Method, ": ", req.URL)
 	e.lastRequest = req
@@ -143,8 +250,24 @@ func (e *HTTPExecutor) fromModelRequest(req *http.Request, modelRequest *model.R
 		if *header.Key == "Content-Type" {
 			contentTypeIsSet = true
 		}
+		// When there's a cookie jar it was seeded with the recorded cookies
+		// and it'll add them (with any live updates) itself.
+		if e.client.Jar != nil && http.CanonicalHeaderKey(*header.Key) == "Cookie" {
+			continue
+		}
 		req.Header.Set(*header.Key, *header.Value)
 	}
+
+	// Browsers record the cookies both as a "Cookie" header and as a list. If
+	// the header came through we've already sent them.
+	if e.client.Jar == nil && req.Header.Get("Cookie") == "" {
+		for _, cookie := range modelRequest.Cookies {
+			req.AddCookie(&http.Cookie{
+				Name:  *cookie.Key,
+				Value: *cookie.Value,
+			})
+		}
+	}
 	if contentTypeIsSet {
 		return
 	}
@@ -167,25 +290,109 @@ func (e *HTTPExecutor) GetLastRequest() *http.Request {
 	return e.lastRequest
 }
 
-// Reads the body into a byte slice, uncompresses it if necessary.
+// Reads the body into a byte slice, uncompresses it if necessary. Responses
+// that can't have a body (to HEAD requests, 204s and 304s) may still say
+// they're gzipped, so there's only something to uncompress if there's a body.
 func (e *HTTPExecutor) readBody(req *http.Response) []byte {
-	var body []byte
-	var err error
-	switch req.Header.Get("Content-Encoding") {
-	case "gzip":
-		reader, _ := gzip.NewReader(req.Body)
-		defer reader.Close()
-		body, err = ioutil.ReadAll(reader)
-		if err != nil {
-			e.log("error reading gzipped http response body: ", err)
-		}
-	default:
-		body, err = ioutil.ReadAll(req.Body)
-		if err != nil {
-			e.log("error reading uncompressed http response body: ", err)
-		}
+	body, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		e.log("error reading http response body: ", err)
+	}
+	if req.Header.Get("Content-Encoding") != "gzip" || len(body) == 0 || !hasBody(req) {
+		return body
+	}
+	reader, err := gzip.NewReader(bytes.NewReader(body))
+	if err != nil {
+		e.log("error reading gzipped http response body: ", err)
+		return body
+	}
+	defer reader.Close()
+	uncompressed, err := ioutil.ReadAll(reader)
+	if err != nil {
+		e.log("error reading gzipped http response body: ", err)
 	}
-	return body
+	return uncompressed
+}
+
+// hasBody says whether a response is allowed to have a body at all
+func hasBody(h *http.Response) bool {
+	if h.Request != nil && h.Request.Method == "HEAD" {
+		return false
+	}
+	return h.StatusCode != http.StatusNoContent && h.StatusCode != http.StatusNotModified
+}
+
+// tracer collects the timings of each phase of a single round trip through
+// net/http/httptrace. The callbacks can come from the transport's own
+// goroutines so everything is behind a mutex.
+type tracer struct {
+	m            sync.Mutex
+	start        time.Time
+	dnsStart     time.Time
+	connectStart time.Time
+	tlsStart     time.Time
+	trace        model.Trace
+}
+
+func (t *tracer) clientTrace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) {
+			t.m.Lock()
+			defer t.m.Unlock()
+			t.dnsStart = time.Now()
+		},
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			t.m.Lock()
+			defer t.m.Unlock()
+			t.trace.DNS = time.Since(t.dnsStart)
+		},
+		ConnectStart: func(_, _ string) {
+			t.m.Lock()
+			defer t.m.Unlock()
+			t.connectStart = time.Now()
+		},
+		ConnectDone: func(_, _ string, _ error) {
+			t.m.Lock()
+			defer t.m.Unlock()
+			t.trace.Connect = time.Since(t.connectStart)
+		},
+		TLSHandshakeStart: func() {
+			t.m.Lock()
+			defer t.m.Unlock()
+			t.tlsStart = time.Now()
+		},
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			t.m.Lock()
+			defer t.m.Unlock()
+			t.trace.TLS = time.Since(t.tlsStart)
+		},
+		GotFirstResponseByte: func() {
+			t.m.Lock()
+			defer t.m.Unlock()
+			t.trace.TTFB = time.Since(t.start)
+		},
+	}
+}
+
+// finish stops the clock and returns a copy of everything that was traced
+func (t *tracer) finish() *model.Trace {
+	t.m.Lock()
+	defer t.m.Unlock()
+	trace := t.trace
+	trace.Total = time.Since(t.start)
+	return &trace
+}
+
+// countingReader remembers how many bytes have been read through it
+type countingReader struct {
+	io.ReadCloser
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+	c.n += int64(n)
+	return n, err
 }
 
 // Logger encapsulates printing to the screen or a file or a variable
@@ -1,10 +1,15 @@
 package runner
 
 import (
+	"bytes"
+	"compress/gzip"
 	"encoding/json"
 	"io/ioutil"
+	"mime"
+	"mime/multipart"
 	"net/http"
 	"os"
+	"strings"
 	"testing"
 	"time"
 
@@ -62,7 +67,8 @@ func TestGet(t *testing.T) {
 	responseBody = "This should be the body"
 
 	request := model.Request{
-		URL: "http://localhost:9797/",
+		Method: "GET",
+		URL:    "http://localhost:9797/",
 		Headers: []model.SingleItemMap{
 			{
 				Key:   util.StringPtr("X-REQUEST-HEADER"), // NB: net/http will modify the case of this string
@@ -70,7 +76,7 @@ func TestGet(t *testing.T) {
 			},
 		},
 	}
-	response, err := executor.Get(request)
+	response, err := executor.Do(request)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -94,7 +100,8 @@ func TestGetWithElaborateHeadersAndQueryString(t *testing.T) {
 	executor := NewHTTPExecutor("anyname", os.Stdout).(*HTTPExecutor)
 
 	request := model.Request{
-		URL: "http://localhost:9797/kate/heddleston?query=string",
+		Method: "GET",
+		URL:    "http://localhost:9797/kate/heddleston?query=string",
 		QueryString: []model.SingleItemMap{
 			{
 				Key:   util.StringPtr("Second"),
@@ -112,7 +119,7 @@ func TestGetWithElaborateHeadersAndQueryString(t *testing.T) {
 			},
 		},
 	}
-	_, err := executor.Get(request)
+	_, err := executor.Do(request)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -130,7 +137,9 @@ func TestGetWithElaborateHeadersAndQueryString(t *testing.T) {
 	if req.URL.Path != "/kate/heddleston" {
 		t.Errorf("path was not properly incorporated into the URL: %s, %s", req.URL.Path, req.URL)
 	}
-	if req.URL.RawQuery != "query=string" {
+	// The queryString list is what transforms modify so it wins over the
+	// query that was recorded in the URL
+	if req.URL.RawQuery != "Second=QueryValue" {
 		t.Errorf("query string was not properly incorporated into the URL: %s, %s", req.URL.RawQuery, req.URL)
 	}
 }
@@ -146,8 +155,9 @@ func TestPost(t *testing.T) {
 	// And define a body we hope to retrieve
 	responseBody = "This should be the body"
 
-	response, err := executor.Post(model.Request{
-		URL: "http://localhost:9797/",
+	response, err := executor.Do(model.Request{
+		Method: "POST",
+		URL:    "http://localhost:9797/",
 		PostData: &model.PostData{
 			MimeType: "application/json",
 			Text:     `{"Nickname": "Jenny", "Role": "Team Captain"}`,
@@ -179,6 +189,343 @@ func TestPost(t *testing.T) {
 	}
 }
 
+func TestPut(t *testing.T) {
+	executor := NewHTTPExecutor("tester", os.Stdout)
+
+	responseHeaders["Time"] = "evening"
+	responseBody = "updated"
+
+	response, err := executor.Do(model.Request{
+		Method: "PUT",
+		URL:    "http://localhost:9797/users/7",
+		Cookies: []model.Cookie{
+			{
+				SingleItemMap: model.SingleItemMap{
+					Key:   util.StringPtr("session"),
+					Value: util.StringPtr("abc123"),
+				},
+			},
+		},
+		PostData: &model.PostData{
+			MimeType: "application/json",
+			Text:     `{"Nickname": "Jenny"}`,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if performedRequest.Method != "PUT" {
+		t.Errorf("Expected a PUT, got: %s", performedRequest.Method)
+	}
+	if performedRequestBody != `{"Nickname": "Jenny"}` {
+		t.Errorf("Expected a particular request body, got: %s ", performedRequestBody)
+	}
+	if cookie, err := performedRequest.Cookie("session"); err != nil || cookie.Value != "abc123" {
+		t.Errorf("Expected the session cookie to be sent, got: %#v", performedRequest.Cookies())
+	}
+	if performedRequest.Header.Get("Content-Type") != "application/json" {
+		t.Errorf("Expected Content-Type from the PostData, got: %s", performedRequest.Header.Get("Content-Type"))
+	}
+	if response.Status != 200 {
+		t.Errorf("Expected HTTP 200 OK, got: %#v", response.Status)
+	}
+	if !hasHeader(response.Headers, "Time", "evening") {
+		t.Errorf("Couldn't find the test header in\n %s", printSingleItemMaps(response.Headers))
+	}
+	if *response.ContentBody != "updated" || response.Content.Size != len("updated") {
+		t.Errorf("Unexpected body content: %s (%d)", *response.ContentBody, response.Content.Size)
+	}
+}
+
+func TestDelete(t *testing.T) {
+	executor := NewHTTPExecutor("tester", os.Stdout)
+	responseBody = ""
+
+	response, err := executor.Do(model.Request{
+		Method: "DELETE",
+		URL:    "http://localhost:9797/users/7",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if performedRequest.Method != "DELETE" {
+		t.Errorf("Expected a DELETE, got: %s", performedRequest.Method)
+	}
+	if performedRequestBody != "" {
+		t.Errorf("Expected no request body, got: %s ", performedRequestBody)
+	}
+	if response.Status != 200 {
+		t.Errorf("Expected HTTP 200 OK, got: %#v", response.Status)
+	}
+}
+
+func TestHead(t *testing.T) {
+	executor := NewHTTPExecutor("tester", os.Stdout)
+
+	responseHeaders["Time"] = "midnight"
+	responseBody = "never sent for a HEAD"
+
+	response, err := executor.Do(model.Request{
+		Method: "HEAD",
+		URL:    "http://localhost:9797/",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if performedRequest.Method != "HEAD" {
+		t.Errorf("Expected a HEAD, got: %s", performedRequest.Method)
+	}
+	if !hasHeader(response.Headers, "Time", "midnight") {
+		t.Errorf("Couldn't find the test header in\n %s", printSingleItemMaps(response.Headers))
+	}
+	if *response.ContentBody != "" {
+		t.Errorf("Expected no body for a HEAD, got: %s", *response.ContentBody)
+	}
+}
+
+func TestGzippedResponsesWithoutBodies(t *testing.T) {
+	executor := NewHTTPExecutor("tester", os.Stdout)
+	responseHeaders["Content-Encoding"] = "gzip"
+	defer delete(responseHeaders, "Content-Encoding")
+
+	compressed := &bytes.Buffer{}
+	writer := gzip.NewWriter(compressed)
+	writer.Write([]byte("uncompressed at last"))
+	writer.Close()
+	responseBody = compressed.String()
+
+	// Recorded requests ask for gzip themselves so net/http leaves the
+	// uncompressing to us
+	acceptGzip := []model.SingleItemMap{{Key: util.StringPtr("Accept-Encoding"), Value: util.StringPtr("gzip")}}
+
+	// A HEAD says what a GET would be encoded with but has no body
+	response, err := executor.Do(model.Request{Method: "HEAD", URL: "http://localhost:9797/", Headers: acceptGzip})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *response.ContentBody != "" {
+		t.Errorf("Expected no body for a HEAD, got: %q", *response.ContentBody)
+	}
+
+	response, err = executor.Do(model.Request{Method: "GET", URL: "http://localhost:9797/", Headers: acceptGzip})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *response.ContentBody != "uncompressed at last" {
+		t.Errorf("Expected the body to be uncompressed, got: %q", *response.ContentBody)
+	}
+}
+
+func TestPatch(t *testing.T) {
+	executor := NewHTTPExecutor("tester", os.Stdout)
+	responseBody = "patched"
+
+	response, err := executor.Do(model.Request{
+		Method: "PATCH",
+		URL:    "http://localhost:9797/users/7",
+		PostData: &model.PostData{
+			MimeType: "application/merge-patch+json",
+			Text:     `{"Role": "Team Captain"}`,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if performedRequest.Method != "PATCH" {
+		t.Errorf("Expected a PATCH, got: %s", performedRequest.Method)
+	}
+	if performedRequestBody != `{"Role": "Team Captain"}` {
+		t.Errorf("Expected a particular request body, got: %s ", performedRequestBody)
+	}
+	if *response.ContentBody != "patched" {
+		t.Errorf("Unexpected body content: %s", *response.ContentBody)
+	}
+}
+
+func TestArbitraryVerbs(t *testing.T) {
+	executor := NewHTTPExecutor("tester", os.Stdout)
+	responseBody = ""
+
+	for _, verb := range []string{"OPTIONS", "TRACE", "PROPFIND", "PURGE"} {
+		_, err := executor.Do(model.Request{
+			Method: verb,
+			URL:    "http://localhost:9797/anything",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if performedRequest.Method != verb {
+			t.Errorf("Expected a %s, got: %s", verb, performedRequest.Method)
+		}
+	}
+}
+
+func TestQueryStringIsRebuiltInOrder(t *testing.T) {
+	executor := NewHTTPExecutor("tester", os.Stdout)
+
+	_, err := executor.Do(model.Request{
+		Method: "GET",
+		URL:    "http://localhost:9797/search?q=recorded&page=1",
+		QueryString: []model.SingleItemMap{
+			{Key: util.StringPtr("q"), Value: util.StringPtr("two words")},
+			{Key: util.StringPtr("page"), Value: util.StringPtr("2")},
+			{Key: util.StringPtr("tz"), Value: util.StringPtr("America%2FLos_Angeles")},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if performedRequest.URL.Path != "/search" {
+		t.Errorf("Expected the path to be untouched, got: %s", performedRequest.URL.Path)
+	}
+	if performedRequest.URL.RawQuery != "q=two+words&page=2&tz=America%2FLos_Angeles" {
+		t.Errorf("Unexpected query string: %s", performedRequest.URL.RawQuery)
+	}
+}
+
+func TestRecordedValuesAreSentAsTheyWere(t *testing.T) {
+	executor := NewHTTPExecutor("tester", os.Stdout)
+
+	_, err := executor.Do(model.Request{
+		Method: "POST",
+		URL:    "http://localhost:9797/search",
+		QueryString: []model.SingleItemMap{
+			{Key: util.StringPtr("q"), Value: util.StringPtr("a+b")},
+			{Key: util.StringPtr("plus"), Value: util.StringPtr("%2B1")},
+			{Key: util.StringPtr("bad"), Value: util.StringPtr("100%")},
+		},
+		PostData: &model.PostData{
+			MimeType: "application/x-www-form-urlencoded",
+			Params: []model.SingleItemMap{
+				{Key: util.StringPtr("phone"), Value: util.StringPtr("+15555550100")},
+				{Key: util.StringPtr("sum"), Value: util.StringPtr("1%2B1=2")},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if performedRequest.URL.RawQuery != "q=a+b&plus=%2B1&bad=100%25" {
+		t.Errorf("Expected + and %%2B to be sent as recorded, got: %s", performedRequest.URL.RawQuery)
+	}
+	if performedRequestBody != "phone=+15555550100&sum=1%2B1%3D2" {
+		t.Errorf("Expected + and %%2B to be sent as recorded, got: %s", performedRequestBody)
+	}
+}
+
+func TestPostParamsAreURLEncoded(t *testing.T) {
+	executor := NewHTTPExecutor("tester", os.Stdout)
+
+	_, err := executor.Do(model.Request{
+		Method: "POST",
+		URL:    "http://localhost:9797/login",
+		PostData: &model.PostData{
+			MimeType: "application/x-www-form-urlencoded",
+			Params: []model.SingleItemMap{
+				{Key: util.StringPtr("user"), Value: util.StringPtr("jenny")},
+				{Key: util.StringPtr("password"), Value: util.StringPtr("p@ss word")},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if performedRequestBody != "user=jenny&password=p%40ss+word" {
+		t.Errorf("Unexpected request body: %s", performedRequestBody)
+	}
+	if performedRequest.Header.Get("Content-Type") != "application/x-www-form-urlencoded" {
+		t.Errorf("Unexpected Content-Type: %s", performedRequest.Header.Get("Content-Type"))
+	}
+}
+
+func TestPostParamsAreMultipartEncoded(t *testing.T) {
+	executor := NewHTTPExecutor("tester", os.Stdout)
+
+	_, err := executor.Do(model.Request{
+		Method: "POST",
+		URL:    "http://localhost:9797/upload",
+		Headers: []model.SingleItemMap{
+			{
+				Key:   util.StringPtr("Content-Type"),
+				Value: util.StringPtr("multipart/form-data; boundary=----RecordedBoundary"),
+			},
+		},
+		PostData: &model.PostData{
+			MimeType: "multipart/form-data; boundary=----RecordedBoundary",
+			Params: []model.SingleItemMap{
+				{Key: util.StringPtr("title"), Value: util.StringPtr("Team Captain")},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mediaType, params, err := mime.ParseMediaType(performedRequest.Header.Get("Content-Type"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mediaType != "multipart/form-data" || params["boundary"] == "----RecordedBoundary" {
+		t.Fatalf("Expected a fresh multipart boundary, got: %s", performedRequest.Header.Get("Content-Type"))
+	}
+	form, err := multipart.NewReader(strings.NewReader(performedRequestBody), params["boundary"]).ReadForm(1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if form.Value["title"][0] != "Team Captain" {
+		t.Errorf("Unexpected form values: %#v", form.Value)
+	}
+}
+
+func TestResponsesAreTraced(t *testing.T) {
+	executor := NewHTTPExecutor("tester", os.Stdout)
+	responseBody = "twenty bytes of body"
+
+	response, err := executor.Do(model.Request{
+		Method: "POST",
+		URL:    "http://localhost:9797/",
+		PostData: &model.PostData{
+			Text: "ten bytes!",
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	trace := response.Trace
+	if trace == nil {
+		t.Fatal("Expected the response to be traced")
+	}
+	if trace.BytesIn != 20 || trace.BytesOut != 10 {
+		t.Errorf("Unexpected byte counts: %d in, %d out", trace.BytesIn, trace.BytesOut)
+	}
+	if trace.TTFB <= 0 || trace.Total < trace.TTFB {
+		t.Errorf("Unexpected timings: ttfb %s, total %s", trace.TTFB, trace.Total)
+	}
+}
+
+func TestConnectionErrorsAreReturned(t *testing.T) {
+	executor := NewHTTPExecutor("tester", ioutil.Discard)
+
+	response, err := executor.Do(model.Request{
+		Method: "GET",
+		URL:    "http://127.0.0.1:1/",
+	})
+	if err == nil {
+		t.Fatal("Expected an error connecting to a closed port")
+	}
+	if response.Trace == nil || response.Trace.Total <= 0 {
+		t.Errorf("Expected even a failed request to be timed, got: %#v", response.Trace)
+	}
+}
+
 // Test Helperrs
 
 func stdLibHeadersToModel(header http.Header) []model.SingleItemMap {
@@ -0,0 +1,388 @@
+package runner
+
+import (
+	"errors"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/JackDanger/traffic/model"
+	"github.com/JackDanger/traffic/transforms"
+	"github.com/JackDanger/traffic/util"
+)
+
+// Group replays one HAR with several concurrent sessions, each of which plays
+// through the whole HAR a number of times. It's what a load test started from
+// the web UI is made of: "archive 12, 20 sessions, 5 times each".
+//
+// Every pass through the HAR is its own HarRunner with its own cookies and a
+// fresh set of transforms, so nothing captured in one pass leaks into the
+// next.
+type Group struct {
+	ID          string
+	ArchiveID   int64
+	Har         *model.Har
+	Concurrency int
+	Iterations  int // how many times each session plays through the HAR
+	Velocity    float64
+	StartTime   time.Time
+	EndTime     time.Time // zero until every session is finished
+
+	// Transforms builds the transforms for each pass through the HAR
+	Transforms func() ([]transforms.RequestTransform, error)
+	// NewExecutor builds the executor for each session
+	NewExecutor func(name string) Executor
+	// Options are applied to every HarRunner
+	Options []Option
+	// OnResult is called with every Result from every session, from many
+	// goroutines at once
+	OnResult []func(Result)
+	// TickEvery is how often a Tick is sent to subscribers
+	TickEvery time.Duration
+
+	m           sync.Mutex
+	resumed     *sync.Cond // signalled when a paused group continues or is killed
+	state       GroupState
+	feeders     *transforms.Feeders  // shared by every session
+	counters    *transforms.Counters // shared by every session
+	sessions    []*groupSession
+	stats       *Stats
+	window      *Stats // the results since the last Tick
+	subscribers map[chan Tick]bool
+	done        chan struct{}
+}
+
+// GroupState is where a Group is in its lifecycle
+type GroupState string
+
+const (
+	// GroupRunning is a group that's replaying its HAR
+	GroupRunning GroupState = "running"
+	// GroupPaused is a group that won't send another request until it's
+	// continued. Requests that were in flight when it was paused still finish.
+	GroupPaused GroupState = "paused"
+	// GroupKilled is a group that was stopped before it finished
+	GroupKilled GroupState = "killed"
+	// GroupFinished is a group whose sessions all played every iteration
+	GroupFinished GroupState = "finished"
+)
+
+// groupSession is the progress of one of a Group's sessions
+type groupSession struct {
+	iteration  int
+	entryIndex int    // the last entry played in this iteration, -1 before the first
+	current    Runner // the HarRunner playing the current iteration, if any
+}
+
+// SessionStatus is the progress of one of a Group's sessions
+type SessionStatus struct {
+	Iteration  int `json:"iteration"`
+	EntryIndex int `json:"entry_index"`
+}
+
+// GroupStatus is a snapshot of how a Group is doing
+type GroupStatus struct {
+	ID          string          `json:"id"`
+	ArchiveID   int64           `json:"archive_id"`
+	Concurrency int             `json:"concurrency"`
+	Iterations  int             `json:"iterations"`
+	Velocity    float64         `json:"velocity"`
+	Entries     int             `json:"entries"` // how many entries are in the HAR
+	State       GroupState      `json:"state"`
+	StartTime   time.Time       `json:"start_time"`
+	EndTime     *time.Time      `json:"end_time,omitempty"`
+	Elapsed     time.Duration   `json:"elapsed"`
+	Done        bool            `json:"done"`
+	Sessions    []SessionStatus `json:"sessions"`
+	Summary     Summary         `json:"summary"`
+}
+
+// This is the list of every Group that's running or finished recently, so
+// their results can be looked up after they're done.
+type groupList struct {
+	items map[string]*Group
+	m     sync.Mutex
+}
+
+var groups = &groupList{
+	items: map[string]*Group{},
+}
+
+// GroupRetention is how long a finished (or killed) Group can still be found
+// by FindGroup and Groups. After that it's forgotten, anything that needs to
+// be kept for longer, like a run's history, has to be stored elsewhere.
+var GroupRetention = time.Hour
+
+// expire forgets the groups that finished more than GroupRetention ago. The
+// caller holds the lock.
+func (l *groupList) expire(now time.Time) {
+	for id, g := range l.items {
+		g.m.Lock()
+		ended := g.EndTime
+		g.m.Unlock()
+		if !ended.IsZero() && now.Sub(ended) > GroupRetention {
+			delete(l.items, id)
+		}
+	}
+}
+
+// NewGroup prepares a Group that plays the HAR with no transforms over HTTP.
+// Change any of its fields before calling Start.
+func NewGroup(har *model.Har, concurrency, iterations int, velocity float64) *Group {
+	g := &Group{
+		ID:          util.UUID(),
+		Har:         har,
+		Concurrency: concurrency,
+		Iterations:  iterations,
+		Velocity:    velocity,
+		Transforms: func() ([]transforms.RequestTransform, error) {
+			return nil, nil
+		},
+		NewExecutor: func(name string) Executor {
+			return NewHTTPExecutor(name, os.Stdout)
+		},
+		TickEvery:   time.Second,
+		state:       GroupRunning,
+		feeders:     transforms.NewFeeders(),
+		counters:    transforms.NewCounters(),
+		stats:       NewStats(),
+		window:      NewStats(),
+		subscribers: map[chan Tick]bool{},
+		done:        make(chan struct{}),
+	}
+	g.resumed = sync.NewCond(&g.m)
+	return g
+}
+
+// Start launches every session in the background and returns right away. It
+// fails without starting anything if the transforms can't be built.
+func (g *Group) Start() error {
+	if g.Concurrency < 1 {
+		return errors.New("a group needs at least one session")
+	}
+	if g.Iterations < 1 {
+		g.Iterations = 1
+	}
+	if _, err := g.buildTransforms(); err != nil {
+		return err
+	}
+
+	groups.m.Lock()
+	if groups.items[g.ID] != nil {
+		groups.m.Unlock()
+		return errors.New("Attempting to start the same Group twice")
+	}
+	g.StartTime = time.Now()
+	groups.expire(g.StartTime)
+	groups.items[g.ID] = g
+	groups.m.Unlock()
+
+	g.sessions = make([]*groupSession, g.Concurrency)
+	for i := range g.sessions {
+		g.sessions[i] = &groupSession{entryIndex: -1}
+	}
+
+	sessions := sync.WaitGroup{}
+	for i := 0; i < g.Concurrency; i++ {
+		sessions.Add(1)
+		go func(num int) {
+			defer sessions.Done()
+			g.session(num)
+		}(i)
+	}
+	go func() {
+		sessions.Wait()
+		g.m.Lock()
+		g.EndTime = time.Now()
+		if g.state != GroupKilled {
+			g.state = GroupFinished
+		}
+		g.m.Unlock()
+		close(g.done)
+	}()
+	go g.tick()
+	return nil
+}
+
+// session plays through the HAR Iterations times, one pass after another
+func (g *Group) session(num int) {
+	name := g.ID + " #" + strconv.Itoa(num)
+	executor := g.NewExecutor(name)
+	session := g.sessions[num]
+	for iteration := 0; iteration < g.Iterations; iteration++ {
+		ts, err := g.buildTransforms()
+		if err != nil {
+			// They were built once already in Start so this shouldn't happen
+			return
+		}
+
+		g.m.Lock()
+		for g.state == GroupPaused {
+			g.resumed.Wait()
+		}
+		if g.state == GroupKilled {
+			g.m.Unlock()
+			return
+		}
+		// Start the runner while holding the lock so that a Pause or Kill
+		// can't miss it
+		instance := NewHarRunner(g.Har, executor, ts, g.Velocity, g.Options...)
+		session.iteration = iteration
+		session.entryIndex = -1
+		session.current = instance
+		g.m.Unlock()
+
+		Collect(instance, func(result Result) {
+			g.stats.Add(result)
+			g.m.Lock()
+			g.window.Add(result)
+			g.m.Unlock()
+			for _, each := range g.OnResult {
+				each(result)
+			}
+			g.m.Lock()
+			session.entryIndex = result.EntryIndex
+			g.m.Unlock()
+		})
+
+		g.m.Lock()
+		session.current = nil
+		g.m.Unlock()
+	}
+}
+
+// buildTransforms is a fresh set of transforms for one pass through the HAR,
+// sharing the rows of any feeders and the count of any counters with every
+// other pass
+func (g *Group) buildTransforms() ([]transforms.RequestTransform, error) {
+	ts, err := g.Transforms()
+	if err != nil {
+		return nil, err
+	}
+	if err := transforms.UseFeeders(g.feeders, ts); err != nil {
+		return nil, err
+	}
+	transforms.UseCounters(g.counters, ts)
+	return ts, nil
+}
+
+// Pause stops every session from sending more requests until Continue is
+// called
+func (g *Group) Pause() {
+	g.m.Lock()
+	defer g.m.Unlock()
+
+	if g.state != GroupRunning {
+		return
+	}
+	g.state = GroupPaused
+	for _, session := range g.sessions {
+		if session.current != nil {
+			session.current.Pause()
+		}
+	}
+}
+
+// Continue resumes a paused group
+func (g *Group) Continue() {
+	g.m.Lock()
+	defer g.m.Unlock()
+
+	if g.state != GroupPaused {
+		return
+	}
+	g.state = GroupRunning
+	g.resumed.Broadcast()
+	for _, session := range g.sessions {
+		if session.current != nil {
+			session.current.Continue()
+		}
+	}
+}
+
+// Kill stops every session for good
+func (g *Group) Kill() {
+	g.m.Lock()
+	defer g.m.Unlock()
+
+	if g.state != GroupRunning && g.state != GroupPaused {
+		return
+	}
+	g.state = GroupKilled
+	g.resumed.Broadcast()
+	for _, session := range g.sessions {
+		if session.current != nil {
+			session.current.Kill()
+		}
+	}
+}
+
+// Wait blocks until every session has finished
+func (g *Group) Wait() {
+	<-g.done
+}
+
+// Done is closed once every session has finished
+func (g *Group) Done() <-chan struct{} {
+	return g.done
+}
+
+// Status describes the group's progress so far
+func (g *Group) Status() GroupStatus {
+	g.m.Lock()
+	defer g.m.Unlock()
+
+	status := GroupStatus{
+		ID:          g.ID,
+		ArchiveID:   g.ArchiveID,
+		Concurrency: g.Concurrency,
+		Iterations:  g.Iterations,
+		Velocity:    g.Velocity,
+		Entries:     len(g.Har.Entries),
+		State:       g.state,
+		StartTime:   g.StartTime,
+		Elapsed:     time.Since(g.StartTime),
+		Sessions:    []SessionStatus{},
+		Summary:     g.stats.Summary(),
+	}
+	for _, session := range g.sessions {
+		status.Sessions = append(status.Sessions, SessionStatus{
+			Iteration:  session.iteration,
+			EntryIndex: session.entryIndex,
+		})
+	}
+	if !g.EndTime.IsZero() {
+		status.Done = true
+		status.EndTime = util.TimePtr(g.EndTime)
+		status.Elapsed = g.EndTime.Sub(g.StartTime)
+	}
+	return status
+}
+
+// FindGroup looks up a Group that's been started by its ID, nil if there's
+// no such group or it finished more than GroupRetention ago
+func FindGroup(id string) *Group {
+	groups.m.Lock()
+	defer groups.m.Unlock()
+	groups.expire(time.Now())
+	return groups.items[id]
+}
+
+// Groups lists every Group that's running or finished within the last
+// GroupRetention, oldest first
+func Groups() []*Group {
+	groups.m.Lock()
+	defer groups.m.Unlock()
+	groups.expire(time.Now())
+
+	list := []*Group{}
+	for _, g := range groups.items {
+		list = append(list, g)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].StartTime.Before(list[j].StartTime)
+	})
+	return list
+}
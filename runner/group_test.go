@@ -0,0 +1,272 @@
+package runner
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/JackDanger/traffic/model"
+	"github.com/JackDanger/traffic/transforms"
+	"github.com/JackDanger/traffic/util"
+)
+
+func TestGroupPlaysEverySessionForEveryIteration(t *testing.T) {
+	har := &model.Har{Entries: []model.Entry{*util.MakeEntry(), *util.MakeEntry()}}
+
+	m := sync.Mutex{}
+	executors := []mockExecutor{}
+	transformsBuilt := 0
+
+	group := NewGroup(har, 3, 2, 100.0)
+	group.NewExecutor = func(name string) Executor {
+		m.Lock()
+		defer m.Unlock()
+		executor := testExecutor(t)
+		executors = append(executors, executor)
+		return executor
+	}
+	group.Transforms = func() ([]transforms.RequestTransform, error) {
+		m.Lock()
+		defer m.Unlock()
+		transformsBuilt++
+		return []transforms.RequestTransform{
+			transforms.HeaderInjectionTransform{Key: "X-Session", Value: "yes"},
+		}, nil
+	}
+	observed := 0
+	group.OnResult = append(group.OnResult, func(result Result) {
+		m.Lock()
+		defer m.Unlock()
+		observed++
+	})
+	if err := group.Start(); err != nil {
+		t.Fatal(err)
+	}
+	if FindGroup(group.ID) != group {
+		t.Errorf("Expected the group to be findable by its ID")
+	}
+	group.Wait()
+
+	if len(executors) != 3 {
+		t.Fatalf("Expected one executor per session, got: %d", len(executors))
+	}
+	for _, executor := range executors {
+		if count := len(*executor.ProcessedRequests); count != 4 {
+			t.Errorf("Expected each session to play 2 entries twice, got: %d", count)
+		}
+	}
+	// Once to check they can be built and then once per pass
+	if transformsBuilt != 1+3*2 {
+		t.Errorf("Expected fresh transforms for every pass, built them %d times", transformsBuilt)
+	}
+
+	status := group.Status()
+	if !status.Done || status.EndTime == nil {
+		t.Errorf("Expected the group to be done")
+	}
+	if status.Summary.Requests != 12 {
+		t.Errorf("Expected 12 results, got: %d", status.Summary.Requests)
+	}
+	if observed != 12 {
+		t.Errorf("Expected every result to be passed to OnResult, got: %d", observed)
+	}
+}
+
+func TestGroupSessionsShareCounters(t *testing.T) {
+	entry := util.MakeEntry()
+	entry.Request.URL = "https://example.com/items/SEQUENCE"
+	har := &model.Har{Entries: []model.Entry{*entry, *entry}}
+
+	m := sync.Mutex{}
+	executors := []mockExecutor{}
+	group := NewGroup(har, 2, 2, 100.0)
+	group.NewExecutor = func(name string) Executor {
+		m.Lock()
+		defer m.Unlock()
+		executor := testExecutor(t)
+		executors = append(executors, executor)
+		return executor
+	}
+	group.Transforms = func() ([]transforms.RequestTransform, error) {
+		return []transforms.RequestTransform{
+			&transforms.CounterTransform{Token: "SEQUENCE", Start: 100},
+		}, nil
+	}
+	if err := group.Start(); err != nil {
+		t.Fatal(err)
+	}
+	group.Wait()
+
+	seen := map[string]bool{}
+	for _, executor := range executors {
+		for _, request := range *executor.ProcessedRequests {
+			if seen[request.URL] {
+				t.Errorf("Expected every request to get its own number, %s was sent twice", request.URL)
+			}
+			seen[request.URL] = true
+		}
+	}
+	for i := 100; i < 108; i++ {
+		if url := "https://example.com/items/" + strconv.Itoa(i); !seen[url] {
+			t.Errorf("Expected the sessions to count up through %d together, got: %v", i, seen)
+		}
+	}
+}
+
+func TestFinishedGroupsAreForgotten(t *testing.T) {
+	defer func(retention time.Duration) { GroupRetention = retention }(GroupRetention)
+	GroupRetention = 50 * time.Millisecond
+
+	group := NewGroup(&model.Har{Entries: []model.Entry{*util.MakeEntry()}}, 1, 1, 100.0)
+	group.NewExecutor = func(name string) Executor { return testExecutor(t) }
+	if err := group.Start(); err != nil {
+		t.Fatal(err)
+	}
+	group.Wait()
+	if FindGroup(group.ID) != group {
+		t.Errorf("Expected a group that just finished to still be found")
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	if FindGroup(group.ID) != nil {
+		t.Errorf("Expected the group to be forgotten once it's been finished for longer than GroupRetention")
+	}
+	for _, each := range Groups() {
+		if each == group {
+			t.Errorf("Expected the group not to be listed anymore")
+		}
+	}
+}
+
+func TestGroupNeedsSessions(t *testing.T) {
+	group := NewGroup(&model.Har{}, 0, 1, 1.0)
+	if err := group.Start(); err == nil {
+		t.Errorf("Expected a group with no sessions not to start")
+	}
+}
+
+func TestGroupPauseContinueAndKill(t *testing.T) {
+	// After playing an entry the runner waits until that entry's recorded
+	// time before moving on, so the first two entries are played right away
+	// and the third one 200ms later.
+	har := &model.Har{}
+	for _, ms := range []float64{0, 200, 200} {
+		entry := util.MakeEntry()
+		entry.TimeMs = ms
+		har.Entries = append(har.Entries, *entry)
+	}
+	newGroup := func() *Group {
+		group := NewGroup(har, 2, 1, 1.0)
+		group.NewExecutor = func(name string) Executor {
+			return testExecutor(t)
+		}
+		if err := group.Start(); err != nil {
+			t.Fatal(err)
+		}
+		return group
+	}
+
+	group := newGroup()
+	time.Sleep(50 * time.Millisecond)
+	group.Pause()
+	time.Sleep(300 * time.Millisecond)
+
+	status := group.Status()
+	if status.State != GroupPaused {
+		t.Errorf("Expected the group to be paused, got: %s", status.State)
+	}
+	if status.Summary.Requests != 4 {
+		t.Errorf("Expected each session to hold back its third entry, got %d requests", status.Summary.Requests)
+	}
+	for _, session := range status.Sessions {
+		if session.Iteration != 0 || session.EntryIndex != 1 {
+			t.Errorf("Expected each session to be on the second entry of the first iteration, got: %#v", session)
+		}
+	}
+
+	group.Continue()
+	group.Wait()
+	status = group.Status()
+	if status.State != GroupFinished {
+		t.Errorf("Expected the group to finish, got: %s", status.State)
+	}
+	if status.Summary.Requests != 6 {
+		t.Errorf("Expected every entry to be played after continuing, got %d requests", status.Summary.Requests)
+	}
+
+	group = newGroup()
+	time.Sleep(50 * time.Millisecond)
+	group.Kill()
+	group.Wait()
+	status = group.Status()
+	if status.State != GroupKilled {
+		t.Errorf("Expected the group to be killed, got: %s", status.State)
+	}
+	if status.Summary.Requests >= 6 {
+		t.Errorf("Expected the group to stop early, got %d requests", status.Summary.Requests)
+	}
+
+	// Operating on a group that's done does nothing
+	group.Pause()
+	group.Continue()
+	group.Kill()
+	if state := group.Status().State; state != GroupKilled {
+		t.Errorf("Expected the group to stay killed, got: %s", state)
+	}
+}
+
+func TestGroupTicks(t *testing.T) {
+	har := &model.Har{}
+	for _, ms := range []float64{0, 100, 100} {
+		entry := util.MakeEntry()
+		entry.TimeMs = ms
+		har.Entries = append(har.Entries, *entry)
+	}
+	group := NewGroup(har, 2, 1, 1.0)
+	group.TickEvery = 50 * time.Millisecond
+	group.NewExecutor = func(name string) Executor {
+		return testExecutor(t)
+	}
+
+	if err := group.Start(); err != nil {
+		t.Fatal(err)
+	}
+	ticks, cancel := group.Subscribe()
+	defer cancel()
+
+	all := []Tick{}
+	for tick := range ticks {
+		all = append(all, tick)
+	}
+
+	if len(all) < 2 {
+		t.Fatalf("Expected a tick every 50ms until the group was done, got: %d", len(all))
+	}
+	requests := 0
+	sawActive := false
+	for _, tick := range all {
+		requests += tick.Requests
+		if tick.ActiveSessions == 2 {
+			sawActive = true
+		}
+		if tick.Requests > 0 && (tick.RequestsPerSecond <= 0 || tick.StatusCodes[200] == 0) {
+			t.Errorf("Expected ticks with requests to have a rate and status codes, got: %#v", tick)
+		}
+	}
+	if requests != 6 {
+		t.Errorf("Expected the ticks to add up to every request, got: %d", requests)
+	}
+	if !sawActive {
+		t.Errorf("Expected to see both sessions active at some point")
+	}
+	if last := all[len(all)-1]; last.State != GroupFinished || last.ActiveSessions != 0 {
+		t.Errorf("Expected the last tick to be sent once the group finished, got: %#v", last)
+	}
+
+	// Subscribing to a group that's done gets nothing
+	ticks, _ = group.Subscribe()
+	if _, ok := <-ticks; ok {
+		t.Errorf("Expected no ticks from a group that's done")
+	}
+}
@@ -0,0 +1,211 @@
+package runner
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/JackDanger/traffic/model"
+)
+
+// Result is the record of replaying a single entry from the HAR: what was
+// requested, how the server answered, how long each phase took and how many
+// bytes went back and forth.
+type Result struct {
+	EntryIndex int           `json:"entry_index"`
+	URL        string        `json:"url"`
+	Method     string        `json:"method"`
+	Status     int           `json:"status"`
+	StartTime  time.Time     `json:"start_time"`
+	DNS        time.Duration `json:"dns"`
+	Connect    time.Duration `json:"connect"`
+	TLS        time.Duration `json:"tls"`
+	TTFB       time.Duration `json:"ttfb"`
+	Total      time.Duration `json:"total"`
+	BytesIn    int64         `json:"bytes_in"`
+	BytesOut   int64         `json:"bytes_out"`
+	Error      string        `json:"error,omitempty"`
+	Mismatches []Mismatch    `json:"mismatches,omitempty"` // only when verifying
+}
+
+func newResult(request model.Request, response *model.Response, err error) Result {
+	result := Result{
+		URL:    request.URL,
+		Method: request.Method,
+	}
+	if err != nil {
+		result.Error = err.Error()
+	}
+	if response == nil {
+		return result
+	}
+	result.Status = response.Status
+	if trace := response.Trace; trace != nil {
+		result.DNS = trace.DNS
+		result.Connect = trace.Connect
+		result.TLS = trace.TLS
+		result.TTFB = trace.TTFB
+		result.Total = trace.Total
+		result.BytesIn = trace.BytesIn
+		result.BytesOut = trace.BytesOut
+	}
+	return result
+}
+
+// Failed is true when the request couldn't be performed at all or the server
+// answered with a 5xx.
+func (r Result) Failed() bool {
+	return r.Error != "" || r.Status >= 500
+}
+
+// Collect calls `each` with every Result the runner produces and returns once
+// the runner is done.
+func Collect(r Runner, each func(Result)) {
+	results := r.GetResultChannel()
+	for {
+		select {
+		case result := <-results:
+			each(result)
+		case <-r.GetDoneChannel():
+			// Every result is sent before the runner finishes so whatever's
+			// left is sitting in the buffer.
+			for len(results) > 0 {
+				each(<-results)
+			}
+			return
+		}
+	}
+}
+
+// Stats accumulates Results (from any number of runners) so they can be
+// summarized. It's safe to Add from multiple goroutines.
+type Stats struct {
+	m           sync.Mutex
+	latencies   []time.Duration
+	statusCodes map[int]int
+	errors      int
+	mismatched  int
+	bytesIn     int64
+	bytesOut    int64
+	first       time.Time
+	last        time.Time
+}
+
+// NewStats returns an empty Stats
+func NewStats() *Stats {
+	return &Stats{statusCodes: map[int]int{}}
+}
+
+// Add includes a single Result in the stats
+func (s *Stats) Add(result Result) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	s.latencies = append(s.latencies, result.Total)
+	if result.Status != 0 {
+		s.statusCodes[result.Status]++
+	}
+	if result.Failed() {
+		s.errors++
+	}
+	if len(result.Mismatches) > 0 {
+		s.mismatched++
+	}
+	s.bytesIn += result.BytesIn
+	s.bytesOut += result.BytesOut
+
+	end := result.StartTime.Add(result.Total)
+	if s.first.IsZero() || result.StartTime.Before(s.first) {
+		s.first = result.StartTime
+	}
+	if end.After(s.last) {
+		s.last = end
+	}
+}
+
+// Summary is a point-in-time report of everything added to a Stats
+type Summary struct {
+	Requests    int           `json:"requests"`
+	Errors      int           `json:"errors"`
+	ErrorRate   float64       `json:"error_rate"`
+	Mismatched  int           `json:"mismatched"` // entries that didn't match the recording
+	P50         time.Duration `json:"p50"`
+	P90         time.Duration `json:"p90"`
+	P99         time.Duration `json:"p99"`
+	Elapsed     time.Duration `json:"elapsed"`
+	Throughput  float64       `json:"throughput"` // requests per second
+	BytesIn     int64         `json:"bytes_in"`
+	BytesOut    int64         `json:"bytes_out"`
+	StatusCodes map[int]int   `json:"status_codes"`
+}
+
+// Summary calculates the latency percentiles, throughput and error rate of
+// all the results so far.
+func (s *Stats) Summary() Summary {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	summary := Summary{
+		Requests:    len(s.latencies),
+		Errors:      s.errors,
+		Mismatched:  s.mismatched,
+		BytesIn:     s.bytesIn,
+		BytesOut:    s.bytesOut,
+		StatusCodes: map[int]int{},
+	}
+	for status, count := range s.statusCodes {
+		summary.StatusCodes[status] = count
+	}
+	if summary.Requests == 0 {
+		return summary
+	}
+
+	sorted := make([]time.Duration, len(s.latencies))
+	copy(sorted, s.latencies)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	summary.P50 = percentile(sorted, 50)
+	summary.P90 = percentile(sorted, 90)
+	summary.P99 = percentile(sorted, 99)
+
+	summary.ErrorRate = float64(s.errors) / float64(summary.Requests)
+	summary.Elapsed = s.last.Sub(s.first)
+	if summary.Elapsed > 0 {
+		summary.Throughput = float64(summary.Requests) / summary.Elapsed.Seconds()
+	}
+	return summary
+}
+
+// percentile uses the nearest-rank method on an already-sorted list
+func percentile(sorted []time.Duration, p int) time.Duration {
+	rank := (p*len(sorted) + 99) / 100
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+// String formats the summary for printing at the end of a run
+func (s Summary) String() string {
+	statuses := []int{}
+	for status := range s.StatusCodes {
+		statuses = append(statuses, status)
+	}
+	sort.Ints(statuses)
+	codes := []string{}
+	for _, status := range statuses {
+		codes = append(codes, fmt.Sprintf("%d: %d", status, s.StatusCodes[status]))
+	}
+
+	lines := []string{
+		fmt.Sprintf("requests:   %d in %s", s.Requests, s.Elapsed.Round(time.Millisecond)),
+		fmt.Sprintf("throughput: %.2f req/s", s.Throughput),
+		fmt.Sprintf("latency:    p50 %s, p90 %s, p99 %s", s.P50.Round(time.Millisecond), s.P90.Round(time.Millisecond), s.P99.Round(time.Millisecond)),
+		fmt.Sprintf("errors:     %d (%.2f%%)", s.Errors, s.ErrorRate*100),
+		fmt.Sprintf("mismatched: %d", s.Mismatched),
+		fmt.Sprintf("bytes:      %d in, %d out", s.BytesIn, s.BytesOut),
+		fmt.Sprintf("statuses:   %s", strings.Join(codes, ", ")),
+	}
+	return strings.Join(lines, "\n")
+}
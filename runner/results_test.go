@@ -0,0 +1,93 @@
+package runner
+
+import (
+	"testing"
+	"time"
+
+	"github.com/JackDanger/traffic/util"
+)
+
+func TestRunnerProducesAResultPerEntry(t *testing.T) {
+	har := util.Fixture()
+	executor := testExecutor(t)
+	instance := NewHarRunner(&har, executor, nil, 1000.0)
+
+	results := []Result{}
+	Collect(instance, func(result Result) {
+		results = append(results, result)
+	})
+
+	if len(results) != len(har.Entries) {
+		t.Fatalf("Expected %d results, got %d", len(har.Entries), len(results))
+	}
+	for i, result := range results {
+		if result.EntryIndex != i {
+			t.Errorf("Expected result #%d to be for entry %d, was %d", i, i, result.EntryIndex)
+		}
+		if result.URL != har.Entries[i].Request.URL {
+			t.Errorf("Unexpected URL in result #%d: %s", i, result.URL)
+		}
+		if result.Method != har.Entries[i].Request.Method {
+			t.Errorf("Unexpected method in result #%d: %s", i, result.Method)
+		}
+		if result.Status != executor.Response.Status {
+			t.Errorf("Unexpected status in result #%d: %d", i, result.Status)
+		}
+		if result.StartTime.IsZero() {
+			t.Errorf("Expected result #%d to have a start time", i)
+		}
+	}
+}
+
+func TestStatsSummary(t *testing.T) {
+	stats := NewStats()
+	start := time.Now()
+	// 100 requests taking 1ms, 2ms, ... 100ms, all starting at the same moment
+	for i := 1; i <= 100; i++ {
+		result := Result{
+			Status:    200,
+			StartTime: start,
+			Total:     time.Duration(i) * time.Millisecond,
+			BytesIn:   10,
+			BytesOut:  1,
+		}
+		if i%10 == 0 {
+			result.Status = 503
+		}
+		if i == 1 {
+			result.Status = 0
+			result.Error = "connection refused"
+		}
+		stats.Add(result)
+	}
+
+	summary := stats.Summary()
+	if summary.Requests != 100 {
+		t.Errorf("Expected 100 requests, got %d", summary.Requests)
+	}
+	if summary.P50 != 50*time.Millisecond || summary.P90 != 90*time.Millisecond || summary.P99 != 99*time.Millisecond {
+		t.Errorf("Unexpected percentiles: %s, %s, %s", summary.P50, summary.P90, summary.P99)
+	}
+	if summary.Errors != 11 || summary.ErrorRate != 0.11 {
+		t.Errorf("Expected 11 errors (11%%), got %d (%f)", summary.Errors, summary.ErrorRate)
+	}
+	if summary.StatusCodes[200] != 89 || summary.StatusCodes[503] != 10 {
+		t.Errorf("Unexpected status codes: %#v", summary.StatusCodes)
+	}
+	if summary.Elapsed != 100*time.Millisecond {
+		t.Errorf("Expected the run to have taken 100ms, got %s", summary.Elapsed)
+	}
+	if summary.Throughput != 1000 {
+		t.Errorf("Expected 1000 req/s, got %f", summary.Throughput)
+	}
+	if summary.BytesIn != 1000 || summary.BytesOut != 100 {
+		t.Errorf("Unexpected byte counts: %d in, %d out", summary.BytesIn, summary.BytesOut)
+	}
+}
+
+func TestEmptyStatsSummary(t *testing.T) {
+	summary := NewStats().Summary()
+	if summary.Requests != 0 || summary.P99 != 0 || summary.Throughput != 0 {
+		t.Errorf("Expected an empty summary, got: %#v", summary)
+	}
+}
@@ -2,6 +2,9 @@ package runner
 
 import (
 	"errors"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
 	"sync"
 	"time"
 
@@ -30,6 +33,7 @@ type Runner interface {
 	Continue()
 	Kill()
 	GetDoneChannel() chan bool
+	GetResultChannel() chan Result
 }
 
 // HarRunner encapsulates a single goroutine reading and replaying a HAR
@@ -42,9 +46,34 @@ type HarRunner struct {
 	operationChannel       chan Operation
 	currentEntryNumChannel chan int
 	DoneChannel            chan bool
+	stopped                chan struct{} // closed once the runner is done
+	ResultChannel          chan Result
 	requestTransforms      []transforms.RequestTransform
 	responseTransforms     []transforms.ResponseTransform
 	Executor               Executor
+	CookieJar              http.CookieJar
+	Verification           *Verification       // nil unless live responses should be checked against the HAR
+	Session                *transforms.Session // the variables the transforms share
+}
+
+// Option configures a HarRunner before it starts running
+type Option func(*HarRunner)
+
+// WithVerification compares every live response to the recorded one and
+// reports any Mismatches in the Results.
+func WithVerification(verification *Verification) Option {
+	return func(r *HarRunner) {
+		r.Verification = verification
+	}
+}
+
+// WithSession shares a session's variables with the runner's transforms
+// instead of starting from an empty one, e.g. to carry them across passes
+// through the archive.
+func WithSession(session *transforms.Session) Option {
+	return func(r *HarRunner) {
+		r.Session = session
+	}
 }
 
 var _ Runner = &HarRunner{}
@@ -63,7 +92,7 @@ var runners = &runnerList{
 
 // NewHarRunner accepts a full HAR and begins to replay the contents at the
 // originally-recorded timing intervals.
-func NewHarRunner(har *model.Har, executor Executor, transforms []transforms.RequestTransform, velocity float64) Runner {
+func NewHarRunner(har *model.Har, executor Executor, requestTransforms []transforms.RequestTransform, velocity float64, options ...Option) Runner {
 	runner := &HarRunner{
 		operationChannel:       make(chan Operation, 1),
 		StartTime:              time.Now(),
@@ -71,11 +100,28 @@ func NewHarRunner(har *model.Har, executor Executor, transforms []transforms.Req
 		Velocity:               velocity,
 		Running:                false,
 		DoneChannel:            make(chan bool),
+		ResultChannel:          make(chan Result, len(har.Entries)),
 		currentEntryNumChannel: make(chan int, 1),
 		Executor:               executor,
-		requestTransforms:      transforms,
+		requestTransforms:      requestTransforms,
 	}
 
+	// Each runner is its own browser session with its own cookies. The jar
+	// starts empty and is seeded from each recorded request as it's played.
+	// cookiejar.New never returns an error.
+	runner.CookieJar, _ = cookiejar.New(nil)
+	if e, ok := executor.(CookieJarExecutor); ok {
+		e.SetCookieJar(runner.CookieJar)
+	}
+
+	for _, option := range options {
+		option(runner)
+	}
+	if runner.Session == nil {
+		runner.Session = transforms.NewSession()
+	}
+	transforms.UseSession(runner.Session, runner.requestTransforms)
+
 	runner.Run()
 
 	return runner
@@ -91,6 +137,7 @@ func (r *HarRunner) Run() error {
 	// Add this runner to the list of runners
 	runners.items[r] = true
 	r.Running = true
+	r.stopped = make(chan struct{})
 
 	// And enqueue processing of the first entry
 	r.currentEntryNumChannel <- 0
@@ -99,38 +146,52 @@ func (r *HarRunner) Run() error {
 	// This is the main goroutine that runs all of the entries in the HAR once it
 	// finishes the last entry it exits.
 	go func() {
+		// The entry that came up while we were paused, if any
+		waiting := -1
+		var pausedAt time.Time
 		for {
 			select {
 			// Check if we've been asked to pause or continue or shut down
 			case operation := <-r.operationChannel:
 				if operation == Pause {
 					r.m.Lock()
+					if r.Running {
+						pausedAt = time.Now()
+					}
 					r.Running = false
 					r.m.Unlock()
 				} else if operation == Continue {
 					r.m.Lock()
+					if !r.Running && !pausedAt.IsZero() {
+						// Pick up where we left off rather than rushing to catch
+						// up on the entries we would have played while paused
+						r.StartTime = r.StartTime.Add(time.Since(pausedAt))
+					}
 					r.Running = true
 					r.m.Unlock()
+					if waiting >= 0 {
+						r.currentEntryNumChannel <- waiting
+						waiting = -1
+					}
 				} else if operation == Kill {
-					r.m.Lock()
-					defer r.m.Unlock()
-
-					r.Running = false
-
-					runners.m.Lock()
-					defer runners.m.Unlock()
-					defer delete(runners.items, r) // Remove this instance from the list
-					r.DoneChannel <- true
+					r.finish()
 					return // This is where we shut the whole routine down
 				}
 			// Check if there's another request to make. If so, play it (play()
 			// spawns a goroutine and returns immediately)
 			case entryIndex := <-r.currentEntryNumChannel:
-				if len(r.Har.Entries) > entryIndex {
+				r.m.Lock()
+				running := r.Running
+				r.m.Unlock()
+				if !running {
+					// Hold on to it until we're told to Continue
+					waiting = entryIndex
+				} else if len(r.Har.Entries) > entryIndex {
 					r.play(entryIndex)
 				} else {
 					// We're done!
-					r.operationChannel <- Kill
+					r.finish()
+					return
 				}
 			}
 		}
@@ -139,10 +200,29 @@ func (r *HarRunner) Run() error {
 	return nil
 }
 
+// finish marks the runner as stopped, removes it from the list of running
+// instances and announces that it's done.
+func (r *HarRunner) finish() {
+	r.m.Lock()
+	r.Running = false
+	close(r.stopped)
+	r.m.Unlock()
+
+	// Remove this instance from the list
+	runners.m.Lock()
+	delete(runners.items, r)
+	runners.m.Unlock()
+
+	// Don't hold any locks while waiting for someone to notice
+	r.DoneChannel <- true
+}
+
 func (r *HarRunner) play(index int) {
 	entry := r.Har.Entries[index]
 	go func() {
-		r.Play(&entry)
+		result, _ := r.replay(&entry)
+		result.EntryIndex = index
+		r.record(result)
 		time.Sleep(r.SleepFor(&entry))
 		r.currentEntryNumChannel <- index + 1
 	}()
@@ -150,49 +230,81 @@ func (r *HarRunner) play(index int) {
 
 // Play performs the request described in the Entry
 func (r *HarRunner) Play(entry *model.Entry) error {
-	transformedRequest := r.transformRequest(*entry.Request)
-
-	var err error
-	var response *model.Response
-
-	switch entry.Request.Method {
-	case "GET":
-		response, err = r.Executor.Get(transformedRequest)
-	case "POST":
-		response, err = r.Executor.Post(transformedRequest)
-	case "PUT":
-		response, err = r.Executor.Put(transformedRequest)
-	case "DELETE":
-		response, err = r.Executor.Delete(transformedRequest)
-	case "HEAD":
-		response, err = r.Executor.Head(transformedRequest)
-	case "PATCH":
-		response, err = r.Executor.Patch(transformedRequest)
-	default:
-		return errors.New("No HTTP verb matched")
+	_, err := r.replay(entry)
+	return err
+}
+
+// replay performs the request described in the Entry and describes how it
+// went.
+func (r *HarRunner) replay(entry *model.Entry) (Result, error) {
+	if r.Session == nil {
+		r.Session = transforms.NewSession()
+	}
+	transformedRequest := r.transformRequest(entry.Request.Copy())
+	r.Session.RenderRequest(&transformedRequest)
+
+	r.seedCookies(transformedRequest)
+
+	start := time.Now()
+	response, err := r.Executor.Do(transformedRequest)
+	result := newResult(transformedRequest, response, err)
+	result.StartTime = start
+	if result.Total == 0 {
+		// Not every Executor traces its requests
+		result.Total = time.Since(start)
+	}
+
+	if r.Verification != nil && err == nil && entry.Response != nil {
+		result.Mismatches = r.Verification.Verify(entry.Response, response)
 	}
 
 	if response != nil {
-		r.updateTransformsFromResponse(response)
+		r.updateTransformsFromResponse(response, entry.Response)
 	}
 
-	return err
+	// A transform that couldn't do its job makes the request a failure even
+	// if the server was happy with it
+	for _, transformErr := range r.Session.Errors() {
+		if result.Error == "" {
+			result.Error = transformErr.Error()
+		}
+	}
+
+	return result, err
+}
+
+// record makes the result available on the ResultChannel. The channel is
+// buffered to hold a whole run through the HAR so this only blocks if nobody
+// reads from it and the runner is played again.
+func (r *HarRunner) record(result Result) {
+	if r.ResultChannel != nil {
+		r.ResultChannel <- result
+	}
 }
 
 // Pause halts this runner and the goroutine waits for a Continue() or a Kill()
 func (r *HarRunner) Pause() {
-	r.operationChannel <- Pause
+	r.operate(Pause)
 }
 
 // Continue halts this runner if a Pause was sent. It's not an error to call
 // this multiple times, it's idempotent.
 func (r *HarRunner) Continue() {
-	r.operationChannel <- Continue
+	r.operate(Continue)
 }
 
 // Kill halts this runner and stops the running goroutine
 func (r *HarRunner) Kill() {
-	r.operationChannel <- Kill
+	r.operate(Kill)
+}
+
+// operate sends the operation to the runner's goroutine unless it's already
+// finished, in which case there's nothing to do.
+func (r *HarRunner) operate(operation Operation) {
+	select {
+	case r.operationChannel <- operation:
+	case <-r.stopped:
+	}
 }
 
 // GetDoneChannel exposes doneness
@@ -200,6 +312,11 @@ func (r *HarRunner) GetDoneChannel() chan bool {
 	return r.DoneChannel
 }
 
+// GetResultChannel exposes a Result for every entry as it's played
+func (r *HarRunner) GetResultChannel() chan Result {
+	return r.ResultChannel
+}
+
 // transformRequest modifies the request object and sets up a list of
 // transforms to execute against the upcoming response.
 func (r *HarRunner) transformRequest(request model.Request) model.Request {
@@ -224,17 +341,69 @@ func (r *HarRunner) transformRequest(request model.Request) model.Request {
 // really a "transformResponse" though because we don't bother modifying a
 // response we get from a remote server, we just use the data in the response
 // to produce new RequestTransform instances to use in the future.
-func (r *HarRunner) updateTransformsFromResponse(response *model.Response) {
+// The recorded response, if there is one, is shown to any transforms that
+// want to compare it with the live one.
+func (r *HarRunner) updateTransformsFromResponse(response, recorded *model.Response) {
 
 	// There are always exactly as many requestTransforms as responseTransforms
 	r.requestTransforms = make([]transforms.RequestTransform, len(r.responseTransforms))
 	for i, transform := range r.responseTransforms {
+		if t, ok := transform.(transforms.RecordedResponseTransform); ok && recorded != nil {
+			t.Recorded(recorded)
+		}
 		requestTransform := transform.T(response)
 		if requestTransform == nil {
 			panic("a transform's .T() should never ever return anything but another transform")
 		}
 		r.requestTransforms[i] = requestTransform
 	}
+	// Transforms that replaced themselves share the session too
+	transforms.UseSession(r.Session, r.requestTransforms)
+}
+
+// seedCookies puts the cookies recorded with this request into the cookie jar
+// unless the jar already has a cookie of the same name for this URL. That way
+// the recorded session gets replayed but a cookie that's been set by a live
+// response always wins over the recorded one.
+func (r *HarRunner) seedCookies(request model.Request) {
+	if r.CookieJar == nil {
+		return
+	}
+	u, err := url.Parse(request.URL)
+	if err != nil {
+		return
+	}
+
+	present := map[string]bool{}
+	for _, cookie := range r.CookieJar.Cookies(u) {
+		present[cookie.Name] = true
+	}
+
+	// The cookies show up both in the list and in a "Cookie" header
+	recorded := []*http.Cookie{}
+	for _, cookie := range request.Cookies {
+		recorded = append(recorded, &http.Cookie{Name: *cookie.Key, Value: *cookie.Value})
+	}
+	header := http.Header{}
+	for _, h := range request.Headers {
+		if http.CanonicalHeaderKey(*h.Key) == "Cookie" {
+			header.Add("Cookie", *h.Value)
+		}
+	}
+	recorded = append(recorded, (&http.Request{Header: header}).Cookies()...)
+
+	seeds := []*http.Cookie{}
+	for _, cookie := range recorded {
+		if present[cookie.Name] {
+			continue
+		}
+		present[cookie.Name] = true
+		cookie.Path = "/"
+		seeds = append(seeds, cookie)
+	}
+	if len(seeds) > 0 {
+		r.CookieJar.SetCookies(u, seeds)
+	}
 }
 
 // SleepFor calculates how long has passed since the runner started and,
@@ -245,5 +414,7 @@ func (r *HarRunner) updateTransformsFromResponse(response *model.Response) {
 // Higher `Velocity` equals a shorter sleep between requests
 func (r *HarRunner) SleepFor(entry *model.Entry) time.Duration {
 	pauseDuration := time.Duration(entry.TimeMs/r.Velocity) * time.Millisecond
+	r.m.Lock()
+	defer r.m.Unlock()
 	return r.StartTime.Add(pauseDuration).Sub(time.Now())
 }
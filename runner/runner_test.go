@@ -2,6 +2,8 @@ package runner
 
 import (
 	"encoding/json"
+	"io/ioutil"
+	"net/http/cookiejar"
 	"strings"
 	"testing"
 
@@ -27,6 +29,28 @@ func TestPlay(t *testing.T) {
 	}
 }
 
+func TestPlayAnyVerb(t *testing.T) {
+	executor := testExecutor(t)
+	entry := util.MakeEntry()
+	entry.Request.Method = "OPTIONS"
+	runner := &HarRunner{
+		Har: &model.Har{
+			Entries: []model.Entry{*entry},
+		},
+		Executor: executor,
+	}
+	if err := runner.Play(entry); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(*executor.ProcessedRequests) != 1 {
+		t.Fatalf("Expected exactly one performed request, was: %d", len(*executor.ProcessedRequests))
+	}
+	if verb := (*executor.ProcessedRequests)[0].Verb; verb != "OPTIONS" {
+		t.Errorf("Expected the OPTIONS preflight to be replayed, got: %s", verb)
+	}
+}
+
 func TestRunWholeHar(t *testing.T) {
 
 	har := util.Fixture()
@@ -124,6 +148,195 @@ func TestRunWithComplexTranforms(t *testing.T) {
 	}
 }
 
+func TestPlayLeavesTheRecordingAlone(t *testing.T) {
+	executor := testExecutor(t)
+	entry := util.MakeEntry()
+	headerCount := len(entry.Request.Headers)
+	firstHeader := *entry.Request.Headers[0].Value
+	target, err := transforms.NewTargetTransform("http://localhost:9797")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := []transforms.RequestTransform{
+		transforms.HeaderInjectionTransform{Key: "X-Injected", Value: "yes"},
+		&transforms.ConstantTransform{Search: firstHeader, Replace: "replaced"},
+		target,
+	}
+	runner := &HarRunner{
+		Har:               &model.Har{Entries: []model.Entry{*entry}},
+		Executor:          executor,
+		requestTransforms: ts,
+	}
+	if err := runner.Play(entry); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(entry.Request.Headers) != headerCount {
+		t.Errorf("Expected the recorded request to keep %d headers, got: %d", headerCount, len(entry.Request.Headers))
+	}
+	if *entry.Request.Headers[0].Value != firstHeader {
+		t.Errorf("Expected the recorded header to be untouched, got: %s", *entry.Request.Headers[0].Value)
+	}
+	if !strings.HasPrefix(entry.Request.URL, "https://") {
+		t.Errorf("Expected the recorded URL to be untouched, got: %s", entry.Request.URL)
+	}
+}
+
+func TestCookieJarSeededFromRecordingAndUpdatedFromResponses(t *testing.T) {
+	executor := NewHTTPExecutor("cookies", ioutil.Discard)
+	jar, _ := cookiejar.New(nil)
+	executor.(CookieJarExecutor).SetCookieJar(jar)
+	runner := &HarRunner{
+		Executor:  executor,
+		CookieJar: jar,
+	}
+
+	request := model.Request{
+		Method: "GET",
+		URL:    "http://localhost:9797/login",
+		Cookies: []model.Cookie{
+			{
+				SingleItemMap: model.SingleItemMap{
+					Key:   util.StringPtr("session"),
+					Value: util.StringPtr("recorded"),
+				},
+			},
+			{
+				SingleItemMap: model.SingleItemMap{
+					Key:   util.StringPtr("theme"),
+					Value: util.StringPtr("dark"),
+				},
+			},
+		},
+	}
+
+	// The first request only has the recorded cookies to go on
+	responseHeaders["Set-Cookie"] = "session=live; Path=/"
+	defer delete(responseHeaders, "Set-Cookie")
+	if err := runner.Play(&model.Entry{Request: &request}); err != nil {
+		t.Fatal(err)
+	}
+	if cookie, err := performedRequest.Cookie("session"); err != nil || cookie.Value != "recorded" {
+		t.Errorf("Expected the recorded session cookie to be sent, got: %#v", performedRequest.Cookies())
+	}
+
+	// The second one should use the session the server just gave us
+	if err := runner.Play(&model.Entry{Request: &request}); err != nil {
+		t.Fatal(err)
+	}
+	if cookie, err := performedRequest.Cookie("session"); err != nil || cookie.Value != "live" {
+		t.Errorf("Expected the live session cookie to be sent, got: %#v", performedRequest.Cookies())
+	}
+	if cookie, err := performedRequest.Cookie("theme"); err != nil || cookie.Value != "dark" {
+		t.Errorf("Expected the recorded theme cookie to still be sent, got: %#v", performedRequest.Cookies())
+	}
+	if len(performedRequest.Cookies()) != 2 {
+		t.Errorf("Expected exactly two cookies, got: %#v", performedRequest.Cookies())
+	}
+}
+
+func TestNewHarRunnerSharesItsCookieJar(t *testing.T) {
+	har := util.Fixture()
+	har.Entries = har.Entries[:1]
+	har.Entries[0].Request.URL = "http://localhost:9797/"
+	executor := NewHTTPExecutor("cookies", ioutil.Discard).(*HTTPExecutor)
+	instance := NewHarRunner(&har, executor, nil, 1.0).(*HarRunner)
+	<-instance.GetDoneChannel()
+
+	if instance.CookieJar == nil {
+		t.Fatal("Expected the runner to own a cookie jar")
+	}
+	if executor.client.Jar != instance.CookieJar {
+		t.Error("Expected the executor to use the runner's cookie jar")
+	}
+}
+
+func TestTransformFailuresAreReportedInResults(t *testing.T) {
+	har := util.Fixture()
+	har.Entries = har.Entries[:2]
+	executor := testExecutor(t)
+	executor.Response.ContentBody = util.StringPtr(`{"data": {"users": [{"id": 7}]}}`)
+	session := transforms.NewSession()
+	ts := []transforms.RequestTransform{
+		&transforms.JSONToVariableTransform{URLPattern: "", Path: "$..id", Variable: "user_id"},
+		&transforms.JSONToVariableTransform{URLPattern: "", Path: "$.data.token", Variable: "token"},
+	}
+
+	instance := NewHarRunner(&har, executor, ts, 1000, WithSession(session))
+	results := []Result{}
+	Collect(instance, func(result Result) {
+		results = append(results, result)
+	})
+
+	if userID, _ := session.Get("user_id"); userID != "7" {
+		t.Errorf("Expected the transforms to share the runner's session, got: %q", userID)
+	}
+	if len(results) != 2 {
+		t.Fatalf("Expected a result for each entry, got: %d", len(results))
+	}
+	for _, result := range results {
+		if !strings.Contains(result.Error, "$.data.token") {
+			t.Errorf("Expected the missing path to fail the request, got: %q", result.Error)
+		}
+	}
+}
+
+func TestExtractedVariablesAreUsedInLaterRequests(t *testing.T) {
+	har := util.Fixture()
+	har.Entries = har.Entries[:2]
+	har.Entries[1].Request.URL = "https://example.com/users/{{user_id}}"
+	executor := testExecutor(t)
+	executor.Response.ContentBody = util.StringPtr(`{"data": {"users": [{"id": 7}]}}`)
+	ts := []transforms.RequestTransform{
+		&transforms.JSONToVariableTransform{URLPattern: "", Path: "$..id", Variable: "user_id"},
+	}
+
+	instance := NewHarRunner(&har, executor, ts, 1000)
+	Collect(instance, func(result Result) {
+		if result.Error != "" {
+			t.Errorf("Expected no errors, got: %s", result.Error)
+		}
+	})
+
+	processed := *executor.ProcessedRequests
+	if len(processed) != 2 {
+		t.Fatalf("Expected both entries to be played, got: %d", len(processed))
+	}
+	if processed[1].URL != "https://example.com/users/7" {
+		t.Errorf("Expected the extracted value in the URL, got: %s", processed[1].URL)
+	}
+	if har.Entries[1].Request.URL != "https://example.com/users/{{user_id}}" {
+		t.Errorf("Expected the recording to keep its placeholder, got: %s", har.Entries[1].Request.URL)
+	}
+}
+
+func TestCapturedValuesReplaceRecordedOnes(t *testing.T) {
+	har := util.Fixture()
+	har.Entries = har.Entries[:2]
+	har.Entries[0].Response.Content.Text = `{"order": {"id": 1001}}`
+	har.Entries[1].Request.URL = "https://example.com/orders/1001"
+	executor := testExecutor(t)
+	executor.Response.ContentBody = util.StringPtr(`{"order": {"id": 2002}}`)
+	ts := []transforms.RequestTransform{
+		&transforms.ResponseCaptureTransform{Path: "$.order.id"},
+	}
+
+	instance := NewHarRunner(&har, executor, ts, 1000)
+	Collect(instance, func(result Result) {
+		if result.Error != "" {
+			t.Errorf("Expected no errors, got: %s", result.Error)
+		}
+	})
+
+	processed := *executor.ProcessedRequests
+	if len(processed) != 2 {
+		t.Fatalf("Expected both entries to be played, got: %d", len(processed))
+	}
+	if processed[1].URL != "https://example.com/orders/2002" {
+		t.Errorf("Expected the live ID in place of the recorded one, got: %s", processed[1].URL)
+	}
+}
+
 // TODO: Test all of
 // * pausing & continuing
 // * stopping and trying to continue
@@ -177,28 +390,8 @@ func (e mockExecutor) clone(verb string, original model.Request) {
 	})
 }
 
-func (e mockExecutor) Get(r model.Request) (*model.Response, error) {
-	e.clone("GET", r)
-	return &e.Response, nil
-}
-func (e mockExecutor) Post(r model.Request) (*model.Response, error) {
-	e.clone("POST", r)
-	return &e.Response, nil
-}
-func (e mockExecutor) Put(r model.Request) (*model.Response, error) {
-	e.clone("PUT", r)
-	return &e.Response, nil
-}
-func (e mockExecutor) Delete(r model.Request) (*model.Response, error) {
-	e.clone("DELETE", r)
-	return &e.Response, nil
-}
-func (e mockExecutor) Head(r model.Request) (*model.Response, error) {
-	e.clone("HEAD", r)
-	return &e.Response, nil
-}
-func (e mockExecutor) Patch(r model.Request) (*model.Response, error) {
-	e.clone("PATCH", r)
+func (e mockExecutor) Do(r model.Request) (*model.Response, error) {
+	e.clone(r.Method, r)
 	return &e.Response, nil
 }
 
@@ -0,0 +1,103 @@
+package runner
+
+import (
+	"time"
+)
+
+// Tick summarizes what a Group did during one TickEvery interval (a second,
+// unless it's been changed) so that a dashboard can chart a load test as it
+// happens.
+type Tick struct {
+	Time              time.Time     `json:"time"` // the end of the interval
+	Requests          int           `json:"requests"`
+	RequestsPerSecond float64       `json:"requests_per_second"`
+	Errors            int           `json:"errors"`
+	P50               time.Duration `json:"p50"`
+	P90               time.Duration `json:"p90"`
+	P99               time.Duration `json:"p99"`
+	StatusCodes       map[int]int   `json:"status_codes"`
+	ActiveSessions    int           `json:"active_sessions"` // sessions in the middle of a pass through the HAR
+	State             GroupState    `json:"state"`
+}
+
+// Subscribe returns a channel that receives a Tick every TickEvery until the
+// group is done, after which it's closed. Call cancel to stop listening
+// early. Subscribers that fall behind miss ticks rather than slowing the
+// group down.
+func (g *Group) Subscribe() (ticks <-chan Tick, cancel func()) {
+	g.m.Lock()
+	defer g.m.Unlock()
+
+	channel := make(chan Tick, 8)
+	if !g.EndTime.IsZero() {
+		close(channel)
+		return channel, func() {}
+	}
+	g.subscribers[channel] = true
+	return channel, func() {
+		g.m.Lock()
+		defer g.m.Unlock()
+		if g.subscribers[channel] {
+			delete(g.subscribers, channel)
+			close(channel)
+		}
+	}
+}
+
+// tick sends a Tick to every subscriber each interval and one last one once
+// the group is done
+func (g *Group) tick() {
+	ticker := time.NewTicker(g.TickEvery)
+	defer ticker.Stop()
+
+	last := time.Now()
+	for {
+		select {
+		case now := <-ticker.C:
+			g.broadcast(now.Sub(last), false)
+			last = now
+		case <-g.done:
+			g.broadcast(time.Since(last), true)
+			return
+		}
+	}
+}
+
+// broadcast summarizes the results since the last tick and sends them out
+func (g *Group) broadcast(interval time.Duration, final bool) {
+	g.m.Lock()
+	defer g.m.Unlock()
+
+	summary := g.window.Summary()
+	g.window = NewStats()
+
+	tick := Tick{
+		Time:        time.Now(),
+		Requests:    summary.Requests,
+		Errors:      summary.Errors,
+		P50:         summary.P50,
+		P90:         summary.P90,
+		P99:         summary.P99,
+		StatusCodes: summary.StatusCodes,
+		State:       g.state,
+	}
+	if interval > 0 {
+		tick.RequestsPerSecond = float64(summary.Requests) / interval.Seconds()
+	}
+	for _, session := range g.sessions {
+		if session.current != nil {
+			tick.ActiveSessions++
+		}
+	}
+
+	for subscriber := range g.subscribers {
+		select {
+		case subscriber <- tick:
+		default:
+		}
+		if final {
+			delete(g.subscribers, subscriber)
+			close(subscriber)
+		}
+	}
+}
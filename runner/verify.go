@@ -0,0 +1,103 @@
+package runner
+
+import (
+	"fmt"
+	"math"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/JackDanger/traffic/model"
+)
+
+// Verification describes which parts of a live response have to match the
+// response that was originally recorded in the HAR. The status code and
+// content type are always compared.
+type Verification struct {
+	// Headers lists the response headers whose values have to match exactly
+	Headers []string
+	// BodySizeTolerance is how far the body size may drift from the recorded
+	// one, as a fraction of it. 0.1 allows the body to be 10% bigger or
+	// smaller.
+	BodySizeTolerance float64
+}
+
+// Mismatch is a single way in which a live response differs from the
+// recorded one.
+type Mismatch struct {
+	Field    string `json:"field"`
+	Recorded string `json:"recorded"`
+	Live     string `json:"live"`
+}
+
+func (m Mismatch) String() string {
+	return fmt.Sprintf("%s: recorded %q, live %q", m.Field, m.Recorded, m.Live)
+}
+
+// Verify compares the live response to the recorded one and returns every
+// difference this Verification cares about.
+func (v *Verification) Verify(recorded, live *model.Response) []Mismatch {
+	mismatches := []Mismatch{}
+
+	if recorded.Status != live.Status {
+		mismatches = append(mismatches, Mismatch{
+			Field:    "status",
+			Recorded: strconv.Itoa(recorded.Status),
+			Live:     strconv.Itoa(live.Status),
+		})
+	}
+
+	// Only compare the media type, "text/html; charset=utf-8" and
+	// "text/html" are close enough.
+	if recordedType, liveType := mediaType(recorded.Content.MimeType), mediaType(live.Content.MimeType); recordedType != liveType {
+		mismatches = append(mismatches, Mismatch{
+			Field:    "content type",
+			Recorded: recordedType,
+			Live:     liveType,
+		})
+	}
+
+	for _, name := range v.Headers {
+		recordedValue, liveValue := headerValue(recorded, name), headerValue(live, name)
+		if recordedValue != liveValue {
+			mismatches = append(mismatches, Mismatch{
+				Field:    "header " + http.CanonicalHeaderKey(name),
+				Recorded: recordedValue,
+				Live:     liveValue,
+			})
+		}
+	}
+
+	// Some HAR exporters use -1 when they don't know the size
+	if recorded.Content.Size >= 0 {
+		allowed := v.BodySizeTolerance * float64(recorded.Content.Size)
+		if math.Abs(float64(live.Content.Size-recorded.Content.Size)) > allowed {
+			mismatches = append(mismatches, Mismatch{
+				Field:    "body size",
+				Recorded: strconv.Itoa(recorded.Content.Size),
+				Live:     strconv.Itoa(live.Content.Size),
+			})
+		}
+	}
+
+	return mismatches
+}
+
+func mediaType(contentType string) string {
+	parsed, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return strings.ToLower(strings.TrimSpace(contentType))
+	}
+	return parsed
+}
+
+// headerValue finds the first header with the given name, ignoring case
+func headerValue(response *model.Response, name string) string {
+	for _, header := range response.Headers {
+		if strings.EqualFold(*header.Key, name) {
+			return *header.Value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,82 @@
+package runner
+
+import (
+	"testing"
+
+	"github.com/JackDanger/traffic/model"
+	"github.com/JackDanger/traffic/util"
+)
+
+func TestVerifyMatchingResponses(t *testing.T) {
+	recorded := util.MakeResponse()
+	live := util.MakeResponse()
+	live.Content.MimeType = "application/json; charset=utf-8" // parameters are ignored
+	live.Content.Size = recorded.Content.Size + 100
+
+	verification := &Verification{
+		Headers:           []string{"x-github-media-type"},
+		BodySizeTolerance: 0.01,
+	}
+	if mismatches := verification.Verify(recorded, live); len(mismatches) != 0 {
+		t.Errorf("Expected no mismatches, got: %v", mismatches)
+	}
+}
+
+func TestVerifyMismatchedResponses(t *testing.T) {
+	recorded := util.MakeResponse()
+	live := &model.Response{
+		Status: 404,
+		Headers: []model.SingleItemMap{
+			{Key: util.StringPtr("X-GitHub-Media-Type"), Value: util.StringPtr("github.v4")},
+		},
+	}
+	live.Content.MimeType = "text/html"
+	live.Content.Size = 9
+
+	verification := &Verification{
+		Headers:           []string{"X-GitHub-Media-Type"},
+		BodySizeTolerance: 0.5,
+	}
+	mismatches := verification.Verify(recorded, live)
+
+	fields := map[string]Mismatch{}
+	for _, mismatch := range mismatches {
+		fields[mismatch.Field] = mismatch
+	}
+	if len(fields) != 4 {
+		t.Errorf("Expected 4 mismatches, got: %v", mismatches)
+	}
+	if fields["status"].Recorded != "200" || fields["status"].Live != "404" {
+		t.Errorf("Unexpected status mismatch: %v", fields["status"])
+	}
+	if fields["content type"].Recorded != "application/json" || fields["content type"].Live != "text/html" {
+		t.Errorf("Unexpected content type mismatch: %v", fields["content type"])
+	}
+	if fields["header X-Github-Media-Type"].Live != "github.v4" {
+		t.Errorf("Unexpected header mismatch: %v", mismatches)
+	}
+	if fields["body size"].Live != "9" {
+		t.Errorf("Unexpected body size mismatch: %v", fields["body size"])
+	}
+}
+
+func TestRunnerReportsMismatches(t *testing.T) {
+	har := util.Fixture()
+	// The mock executor always answers with the first entry's response
+	executor := testExecutor(t)
+	instance := NewHarRunner(&har, executor, nil, 1000.0, WithVerification(&Verification{}))
+
+	results := []Result{}
+	Collect(instance, func(result Result) {
+		results = append(results, result)
+	})
+
+	if len(results[0].Mismatches) != 0 {
+		t.Errorf("Expected the first entry to match, got: %v", results[0].Mismatches)
+	}
+	for _, result := range results[1:] {
+		if len(result.Mismatches) == 0 {
+			t.Errorf("Expected entry #%d to have a different body size", result.EntryIndex)
+		}
+	}
+}
@@ -1,6 +1,8 @@
 package server
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"log"
@@ -8,11 +10,15 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gorilla/mux"
 
-	"github.com/JackDanger/traffic/parser"
+	"github.com/JackDanger/traffic/correlation"
 	"github.com/JackDanger/traffic/persistence"
+	"github.com/JackDanger/traffic/queue"
+	"github.com/JackDanger/traffic/runner"
+	"github.com/JackDanger/traffic/transforms"
 	"github.com/JackDanger/traffic/util"
 )
 
@@ -20,10 +26,19 @@ import (
 // terrible idea?
 var db *persistence.DB
 
+// The queue that jobs are handed to workers from
+var jobs queue.Queue
+
 // NewServer returns an instance of http.Server ready to listen on the given
-// port. Calling ListenAndServe on it is a blocking call:
-//   server.NewServer("8080").ListenAndServe()
-func NewServer(port string) (*http.Server, error) {
+// port. Records are kept in the given database and jobs created through it
+// are pushed onto the given queue. Calling ListenAndServe on it is a blocking
+// call:
+//   server.NewServer("8080", db, queue.NewMemoryQueue()).ListenAndServe()
+func NewServer(port string, database *persistence.DB, q queue.Queue) (*http.Server, error) {
+	// Set the global `db` var WTF please open a pull request to fix how I'm
+	// doing this.
+	db = database
+	jobs = q
 
 	r := mux.NewRouter()
 
@@ -33,19 +48,27 @@ func NewServer(port string) (*http.Server, error) {
 	r.HandleFunc("/archives", CreateArchive).Methods("POST")
 	r.HandleFunc("/archives/{id}", UpdateArchive).Methods("PUT")
 	r.HandleFunc("/archives/{id}", DeleteArchive).Methods("DELETE")
+	r.HandleFunc("/archives/{id}/transforms", ListTransforms).Methods("GET")
+	r.HandleFunc("/archives/{id}/transforms", CreateTransform).Methods("POST")
+	r.HandleFunc("/archives/{id}/transforms/{transformID}", GetTransform).Methods("GET")
+	r.HandleFunc("/archives/{id}/transforms/{transformID}", UpdateTransform).Methods("PUT")
+	r.HandleFunc("/archives/{id}/transforms/{transformID}", DeleteTransform).Methods("DELETE")
+	r.HandleFunc("/archives/{id}/correlations", ListCorrelations).Methods("GET")
+	r.HandleFunc("/transform-types", ListTransformTypes).Methods("GET")
 	r.HandleFunc("/start", StartHar).Methods("POST")
+	r.HandleFunc("/runs", ListRuns).Methods("GET")
+	r.HandleFunc("/runs/{operation:pause|continue|kill}", OperateRuns).Methods("POST")
+	r.HandleFunc("/runs/{id}", GetRun).Methods("GET")
+	r.HandleFunc("/runs/{id}/stream", StreamRun).Methods("GET")
+	r.HandleFunc("/runs/{id}/{operation:pause|continue|kill}", OperateRun).Methods("POST")
+	r.HandleFunc("/history", ListHistory).Methods("GET")
+	r.HandleFunc("/history/{id}", GetHistory).Methods("GET")
+	r.HandleFunc("/jobs", CreateJob).Methods("POST")
+	r.HandleFunc("/jobs/{id}", GetJob).Methods("GET")
 
 	handler := newLoggedMux()
 	handler.Handle("/", r)
 
-	var err error
-	// Set the global `db` var WTF please open a pull request to fix how I'm
-	// doing this.
-	db, err = persistence.NewDb()
-	if err != nil {
-		return nil, err
-	}
-
 	return &http.Server{
 		Addr:    "127.0.0.1:" + port,
 		Handler: handler,
@@ -139,8 +162,50 @@ func CreateArchive(w http.ResponseWriter, r *http.Request) {
 	w.Write(archive.AsJSON())
 }
 
+// ListTransforms shows an archive's transforms in the order they're applied
+func ListTransforms(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	archive, err := archiveFromPath(r)
+	if err == persistence.ErrNotFound {
+		notFound(w)
+		return
+	}
+	if err != nil {
+		fail(err, w)
+		return
+	}
+	records, err := db.ListTransformsFor(archive.ID)
+	if err != nil {
+		fail(err, w)
+		return
+	}
+	if records == nil {
+		records = []persistence.Transform{}
+	}
+	content, err := json.Marshal(records)
+	if err != nil {
+		fail(err, w)
+		return
+	}
+
+	w.WriteHeader(200)
+	w.Write(content)
+}
+
 // CreateTransform stores a new transform for a specific archive
 func CreateTransform(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	archive, err := archiveFromPath(r)
+	if err == persistence.ErrNotFound {
+		notFound(w)
+		return
+	}
+	if err != nil {
+		fail(err, w)
+		return
+	}
 	body, err := ioutil.ReadAll(r.Body)
 	if err != nil {
 		fail(err, w)
@@ -149,7 +214,12 @@ func CreateTransform(w http.ResponseWriter, r *http.Request) {
 
 	transform, err := persistence.Transform{}.FromJSON(body)
 	if err != nil {
-		fail(err, w)
+		invalid(err, w)
+		return
+	}
+	transform.ArchiveID = archive.ID
+	if err = transform.Validate(); err != nil {
+		invalid(err, w)
 		return
 	}
 	if err = transform.Create(db); err != nil {
@@ -163,9 +233,180 @@ func CreateTransform(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	w.WriteHeader(200)
+	w.Write(transform.AsJSON())
+}
+
+// GetTransform shows one of an archive's transforms
+func GetTransform(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	transform, err := transformFromPath(r)
+	if err == persistence.ErrNotFound {
+		notFound(w)
+		return
+	}
+	if err != nil {
+		fail(err, w)
+		return
+	}
+
+	w.WriteHeader(200)
 	w.Write(transform.AsJSON())
 }
 
+// UpdateTransform replaces the type, settings, or position of one of an
+// archive's transforms
+func UpdateTransform(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	existing, err := transformFromPath(r)
+	if err == persistence.ErrNotFound {
+		notFound(w)
+		return
+	}
+	if err != nil {
+		fail(err, w)
+		return
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		fail(err, w)
+		return
+	}
+
+	transform, err := persistence.Transform{}.FromJSON(body)
+	if err != nil {
+		invalid(err, w)
+		return
+	}
+	// Which record this is, and whose, comes from the path
+	transform.ID = existing.ID
+	transform.ArchiveID = existing.ArchiveID
+	transform.CreatedAt = existing.CreatedAt
+	transform.UpdatedAt = util.TimePtr(time.Now())
+	if err = transform.Validate(); err != nil {
+		invalid(err, w)
+		return
+	}
+	if _, err = db.Update(transform); err != nil {
+		fail(err, w)
+		return
+	}
+	transform, err = persistence.Transform{}.Get(db, transform.ID)
+	if err != nil {
+		fail(err, w)
+		return
+	}
+
+	w.WriteHeader(200)
+	w.Write(transform.AsJSON())
+}
+
+// DeleteTransform removes one of an archive's transforms
+func DeleteTransform(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	transform, err := transformFromPath(r)
+	if err == persistence.ErrNotFound {
+		notFound(w)
+		return
+	}
+	if err != nil {
+		fail(err, w)
+		return
+	}
+	rowsChanged, err := db.Delete(transform)
+	if err != nil {
+		fail(err, w)
+		return
+	}
+
+	w.WriteHeader(200)
+	w.Write([]byte(fmt.Sprintf(`{"success": "sure", "deleted": %d}`, rowsChanged)))
+}
+
+// ListTransformTypes describes every kind of transform there is, with a JSON
+// Schema of each one's settings, so that forms can be made for them
+func ListTransformTypes(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	content, err := json.Marshal(transforms.Types())
+	if err != nil {
+		fail(err, w)
+		return
+	}
+
+	w.WriteHeader(200)
+	w.Write(content)
+}
+
+// ListCorrelations suggests transforms for the values in an archive that
+// were handed out in one response and sent back in later requests. Any of
+// them can be stored by POSTing its "transform" to the archive's transforms.
+func ListCorrelations(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	archive, err := archiveFromPath(r)
+	if err == persistence.ErrNotFound {
+		notFound(w)
+		return
+	}
+	if err != nil {
+		fail(err, w)
+		return
+	}
+	har, err := archive.Model()
+	if err != nil {
+		invalid(err, w)
+		return
+	}
+	suggestions, err := correlation.Analyze(har, archive.ID)
+	if err != nil {
+		fail(err, w)
+		return
+	}
+	content, err := json.Marshal(suggestions)
+	if err != nil {
+		fail(err, w)
+		return
+	}
+
+	w.WriteHeader(200)
+	w.Write(content)
+}
+
+// archiveFromPath loads the archive named by the {id} in the path
+func archiveFromPath(r *http.Request) (*persistence.Archive, error) {
+	// parse this as base10 into an int64
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		return nil, persistence.ErrNotFound
+	}
+	return persistence.Archive{}.Get(db, id)
+}
+
+// transformFromPath loads the transform named by the {transformID} in the
+// path, as long as it belongs to the archive named by the {id}
+func transformFromPath(r *http.Request) (*persistence.Transform, error) {
+	archive, err := archiveFromPath(r)
+	if err != nil {
+		return nil, err
+	}
+	id, err := strconv.ParseInt(mux.Vars(r)["transformID"], 10, 64)
+	if err != nil {
+		return nil, persistence.ErrNotFound
+	}
+	transform, err := persistence.Transform{}.Get(db, id)
+	if err != nil {
+		return nil, err
+	}
+	if transform.ArchiveID != archive.ID {
+		return nil, persistence.ErrNotFound
+	}
+	return transform, nil
+}
+
 // UpdateArchive modifies an existing archive
 func UpdateArchive(w http.ResponseWriter, r *http.Request) {
 	params := mux.Vars(r)
@@ -189,7 +430,7 @@ func UpdateArchive(w http.ResponseWriter, r *http.Request) {
 
 	archive.ID = id
 
-	rowsChanged, err := db.Update(&archive)
+	rowsChanged, err := db.Update(archive)
 	if err != nil {
 		fail(err, w)
 		return
@@ -213,6 +454,18 @@ func DeleteArchive(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Its transforms are no use without it
+	records, err := db.ListTransformsFor(id)
+	if err != nil {
+		fail(err, w)
+		return
+	}
+	for i := range records {
+		if _, err := db.Delete(&records[i]); err != nil {
+			fail(err, w)
+			return
+		}
+	}
 	rowsChanged, err := db.Delete(&persistence.Archive{ID: id})
 	if err != nil {
 		fail(err, w)
@@ -223,26 +476,402 @@ func DeleteArchive(w http.ResponseWriter, r *http.Request) {
 	w.Write([]byte(fmt.Sprintf(`{"success": "sure", "deleted": %d"}`, rowsChanged)))
 }
 
-// StartHar begins 1 or more runners of a specific HAR file identified by name
-// (for now, eventually it'll be by id from the db)
+// startParams is what the frontend sends to StartHar
+type startParams struct {
+	ArchiveID   int64   `json:"archive_id"`
+	Concurrency int     `json:"concurrency"`
+	Velocity    float64 `json:"velocity"`
+	Iterations  int     `json:"iterations"`   // how many times each session replays the archive
+	StartedBy   string  `json:"started_by"`   // who to credit in the run history, defaults to the client's address
+	SampleEvery int     `json:"sample_every"` // store one in this many successful results (failures are stored up to persistence.DefaultMaxFailures)
+}
+
+// StartHar begins replaying a stored archive, with its transforms, in the
+// background. It responds with the id of the run which can be polled at
+// /runs/{id}.
 func StartHar(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	// TODO: read from the db
-	har, err := parser.HarFrom(util.Root() + "fixtures/browse-two-github-users.har")
 
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		fail(err, w)
+		return
+	}
+	params := startParams{Concurrency: 1, Velocity: 1.0, Iterations: 1, SampleEvery: 100}
+	if err = json.Unmarshal(body, &params); err != nil {
+		invalid(err, w)
+		return
+	}
+	if params.Concurrency < 1 {
+		invalid(errors.New("concurrency must be at least 1"), w)
+		return
+	}
+	if params.Velocity <= 0 {
+		invalid(errors.New("velocity must be more than 0"), w)
+		return
+	}
+
+	archive, err := persistence.Archive{}.Get(db, params.ArchiveID)
+	if err == persistence.ErrNotFound {
+		notFound(w)
+		return
+	}
+	if err != nil {
+		fail(err, w)
+		return
+	}
+	har, err := archive.Model()
+	if err != nil {
+		fail(err, w)
+		return
+	}
+	records, err := db.ListTransformsFor(archive.ID)
+	if err != nil {
+		fail(err, w)
+		return
+	}
+
+	group := runner.NewGroup(har, params.Concurrency, params.Iterations, params.Velocity)
+	group.ArchiveID = archive.ID
+	// Each pass through the archive gets its own transforms because they hold
+	// on to whatever they capture from responses.
+	group.Transforms = func() ([]transforms.RequestTransform, error) {
+		ts := []transforms.RequestTransform{}
+		for _, record := range records {
+			transform, err := record.Model()
+			if err != nil {
+				return nil, err
+			}
+			ts = append(ts, transform)
+		}
+		target, err := archive.TargetTransform()
+		if err != nil {
+			return nil, err
+		}
+		if target != nil {
+			ts = append(ts, target)
+		}
+		return ts, nil
+	}
+
+	// Keep a record of the run and a sample of its results
+	if params.StartedBy == "" {
+		params.StartedBy = r.RemoteAddr
+	}
+	run := persistence.MakeRun(group, params.StartedBy)
+	if err = run.Create(db); err != nil {
+		fail(err, w)
+		return
+	}
+	recorder := persistence.NewRunRecorder(db, run, params.SampleEvery)
+	group.OnResult = append(group.OnResult, recorder.Record)
+
+	if err = group.Start(); err != nil {
+		db.Delete(run)
+		fail(err, w)
+		return
+	}
+	go func() {
+		group.Wait()
+		if err := recorder.Finish(group.Status()); err != nil {
+			log.Printf("couldn't record the end of run %s: %s", group.ID, err)
+		}
+	}()
+
+	w.WriteHeader(200)
+	w.Write([]byte(fmt.Sprintf(`{"success": "sure", "id": %q, "history_id": %d}`, group.ID, run.ID)))
+}
+
+// ListRuns describes every run that's going or finished within the last
+// runner.GroupRetention, oldest first. Older runs are in ListHistory. Pass
+// ?state=running (or paused, killed, finished) to see only some.
+func ListRuns(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	state := runner.GroupState(r.URL.Query().Get("state"))
+	statuses := []runner.GroupStatus{}
+	for _, group := range runner.Groups() {
+		status := group.Status()
+		if state == "" || status.State == state {
+			statuses = append(statuses, status)
+		}
+	}
+	content, err := json.Marshal(statuses)
+	if err != nil {
+		fail(err, w)
+		return
+	}
+
+	w.WriteHeader(200)
+	w.Write(content)
+}
+
+// GetRun describes the progress of a run started with StartHar, or how it
+// ended if it's done
+func GetRun(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	group := runner.FindGroup(mux.Vars(r)["id"])
+	if group == nil {
+		w.WriteHeader(404)
+		w.Write([]byte(`{"success": "nope"}`))
+		return
+	}
+	content, err := json.Marshal(group.Status())
 	if err != nil {
 		fail(err, w)
 		return
 	}
 
-	contentJSON, err := parser.HarToJSON(har)
+	w.WriteHeader(200)
+	w.Write(content)
+}
+
+// StreamRun pushes a summary of the run every second as Server-Sent Events
+// until the run is done or the client goes away. Each event's data is a
+// runner.Tick as JSON. A final "done" event carries the run's status.
+//
+//   var events = new EventSource("/runs/" + id + "/stream")
+//   events.onmessage = function(e) { chart(JSON.parse(e.data)) }
+//
+func StreamRun(w http.ResponseWriter, r *http.Request) {
+	group := runner.FindGroup(mux.Vars(r)["id"])
+	if group == nil {
+		w.WriteHeader(404)
+		w.Write([]byte(`{"success": "nope"}`))
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		fail(fmt.Errorf("streaming isn't supported"), w)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(200)
+	flusher.Flush()
+
+	ticks, cancel := group.Subscribe()
+	defer cancel()
+	for {
+		select {
+		case tick, ok := <-ticks:
+			if !ok {
+				content, _ := json.Marshal(group.Status())
+				fmt.Fprintf(w, "event: done\ndata: %s\n\n", content)
+				flusher.Flush()
+				return
+			}
+			content, err := json.Marshal(tick)
+			if err != nil {
+				return
+			}
+			fmt.Fprintf(w, "data: %s\n\n", content)
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// OperateRun pauses, continues or kills a single run
+func OperateRun(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	params := mux.Vars(r)
+	group := runner.FindGroup(params["id"])
+	if group == nil {
+		w.WriteHeader(404)
+		w.Write([]byte(`{"success": "nope"}`))
+		return
+	}
+	operate(group, params["operation"])
+	content, err := json.Marshal(group.Status())
 	if err != nil {
 		fail(err, w)
 		return
 	}
 
 	w.WriteHeader(200)
-	w.Write([]byte(contentJSON))
+	w.Write(content)
+}
+
+// OperateRuns pauses, continues or kills every run at once
+func OperateRuns(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	operation := mux.Vars(r)["operation"]
+	affected := 0
+	for _, group := range runner.Groups() {
+		if state := group.Status().State; state == runner.GroupRunning || state == runner.GroupPaused {
+			operate(group, operation)
+			affected++
+		}
+	}
+
+	w.WriteHeader(200)
+	w.Write([]byte(fmt.Sprintf(`{"success": "sure", "affected": %d}`, affected)))
+}
+
+func operate(group *runner.Group, operation string) {
+	switch operation {
+	case "pause":
+		group.Pause()
+	case "continue":
+		group.Continue()
+	case "kill":
+		group.Kill()
+	}
+}
+
+// ListHistory lists the runs stored in the database, newest first. Pass
+// ?archive_id= to compare the runs of a single archive.
+func ListHistory(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var archiveID int64
+	if param := r.URL.Query().Get("archive_id"); param != "" {
+		var err error
+		if archiveID, err = strconv.ParseInt(param, 10, 64); err != nil {
+			fail(err, w)
+			return
+		}
+	}
+	runs, err := db.ListRuns(archiveID)
+	if err != nil {
+		fail(err, w)
+		return
+	}
+	content, err := json.Marshal(runs)
+	if err != nil {
+		fail(err, w)
+		return
+	}
+
+	w.WriteHeader(200)
+	w.Write(content)
+}
+
+// GetHistory shows a stored run along with its sampled results
+func GetHistory(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	// parse this as base10 into an int64
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		fail(err, w)
+		return
+	}
+	run, err := persistence.Run{}.Get(db, id)
+	if err == persistence.ErrNotFound {
+		notFound(w)
+		return
+	}
+	if err != nil {
+		fail(err, w)
+		return
+	}
+	results, err := db.ListRunResultsFor(run.ID)
+	if err != nil {
+		fail(err, w)
+		return
+	}
+	content, err := json.Marshal(struct {
+		*persistence.Run
+		Results []persistence.RunResult `json:"results"`
+	}{run, results})
+	if err != nil {
+		fail(err, w)
+		return
+	}
+
+	w.WriteHeader(200)
+	w.Write(content)
+}
+
+// jobParams is what the frontend sends to CreateJob
+type jobParams struct {
+	ArchiveID   int64   `json:"archive_id"`
+	Velocity    float64 `json:"velocity"`
+	Concurrency int     `json:"concurrency"`
+	Duration    string  `json:"duration"` // e.g. "90s" or "5m"
+}
+
+// CreateJob queues up an archive (along with its transforms) to be replayed
+// by whichever worker asks for it first
+func CreateJob(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		fail(err, w)
+		return
+	}
+	params := jobParams{Velocity: 1.0, Concurrency: 1}
+	if err = json.Unmarshal(body, &params); err != nil {
+		invalid(err, w)
+		return
+	}
+	if params.Concurrency < 1 {
+		invalid(errors.New("concurrency must be at least 1"), w)
+		return
+	}
+	if params.Velocity <= 0 {
+		invalid(errors.New("velocity must be more than 0"), w)
+		return
+	}
+	var duration time.Duration
+	if params.Duration != "" {
+		if duration, err = time.ParseDuration(params.Duration); err != nil {
+			invalid(err, w)
+			return
+		}
+	}
+
+	archive, err := persistence.Archive{}.Get(db, params.ArchiveID)
+	if err == persistence.ErrNotFound {
+		notFound(w)
+		return
+	}
+	if err != nil {
+		fail(err, w)
+		return
+	}
+	transforms, err := db.ListTransformsFor(archive.ID)
+	if err != nil {
+		fail(err, w)
+		return
+	}
+
+	job := queue.NewJob(archive, transforms, params.Velocity, params.Concurrency, duration)
+	if err = jobs.Push(job); err != nil {
+		fail(err, w)
+		return
+	}
+
+	w.WriteHeader(200)
+	w.Write([]byte(fmt.Sprintf(`{"success": "sure", "id": %q}`, job.ID)))
+}
+
+// GetJob describes how far along a queued job is
+func GetJob(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	// The queue only fails to describe jobs it doesn't know about
+	status, err := jobs.Status(mux.Vars(r)["id"])
+	if err != nil {
+		notFound(w)
+		return
+	}
+	content, err := json.Marshal(status)
+	if err != nil {
+		fail(err, w)
+		return
+	}
+
+	w.WriteHeader(200)
+	w.Write(content)
 }
 
 // LoggedMux is a wrapper around http.ServeMux that logs all requests to STDERR
@@ -277,3 +906,14 @@ func fail(err error, w http.ResponseWriter) {
 	w.WriteHeader(500)
 	w.Write([]byte(err.Error()))
 }
+
+// invalid tells the client what was wrong with what it sent
+func invalid(err error, w http.ResponseWriter) {
+	w.WriteHeader(400)
+	w.Write([]byte(fmt.Sprintf(`{"success": "nope", "error": %q}`, err.Error())))
+}
+
+func notFound(w http.ResponseWriter) {
+	w.WriteHeader(404)
+	w.Write([]byte(`{"success": "nope"}`))
+}
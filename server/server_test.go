@@ -2,20 +2,43 @@ package server
 
 import (
 	"bytes"
+	"encoding/json"
+	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/gorilla/mux"
+
+	"github.com/JackDanger/traffic/correlation"
 	"github.com/JackDanger/traffic/model"
+	"github.com/JackDanger/traffic/parser"
 	"github.com/JackDanger/traffic/persistence"
+	"github.com/JackDanger/traffic/queue"
+	"github.com/JackDanger/traffic/runner"
+	"github.com/JackDanger/traffic/transforms"
 	"github.com/JackDanger/traffic/util"
 )
 
 func TestMain(m *testing.M) {
-	// Creates the database if necessary
+	// Keep records in a directory of our own unless we've been asked to test
+	// against MySQL. Other packages' tests run at the same time.
 	var err error
+	dir := ""
+	if !strings.HasPrefix(os.Getenv(persistence.DSNVariable), "mysql://") {
+		if dir, err = ioutil.TempDir("", "traffic"); err != nil {
+			panic(err)
+		}
+		os.Setenv(persistence.DSNVariable, "file://"+dir)
+	}
+
+	// Creates the database if necessary
 	// `db` is defined in server.go
 	db, err = persistence.NewDb()
 	if err != nil {
@@ -25,6 +48,9 @@ func TestMain(m *testing.M) {
 	exitCode := m.Run()
 
 	db.Truncate()
+	if dir != "" {
+		os.RemoveAll(dir)
+	}
 
 	os.Exit(exitCode)
 }
@@ -46,8 +72,7 @@ func TestCreateArchive(t *testing.T) {
 	CreateArchive(resp, req)
 
 	// Find the archive from the db
-	var records []persistence.Archive
-	err = db.Select(&records, db.Archives.Select("*"))
+	records, err := db.ListArchives()
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -74,3 +99,409 @@ func TestCreateArchive(t *testing.T) {
 		t.Error("Rendered something other than the actual record in question")
 	}
 }
+
+func TestStartHarRejectsBadRequests(t *testing.T) {
+	archive, err := persistence.MakeArchive("name", "description", &model.Har{Entries: []model.Entry{*util.MakeEntry()}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = archive.Create(db); err != nil {
+		t.Fatal(err)
+	}
+
+	for body, expected := range map[string]int{
+		`{not json`:              400,
+		`{"archive_id": 999999}`: 404,
+		fmt.Sprintf(`{"archive_id": %d, "concurrency": 0}`, archive.ID):  400,
+		fmt.Sprintf(`{"archive_id": %d, "concurrency": -2}`, archive.ID): 400,
+		fmt.Sprintf(`{"archive_id": %d, "velocity": 0}`, archive.ID):     400,
+		fmt.Sprintf(`{"archive_id": %d, "velocity": -1.5}`, archive.ID):  400,
+	} {
+		resp := httptest.NewRecorder()
+		req, err := http.NewRequest("POST", "/start", bytes.NewBufferString(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		StartHar(resp, req)
+		if resp.Code != expected {
+			t.Errorf("Expected %s to be a %d, got %d: %s", body, expected, resp.Code, resp.Body.String())
+		}
+	}
+}
+
+func TestJobsRejectBadRequests(t *testing.T) {
+	archive, err := persistence.MakeArchive("name", "description", &model.Har{Entries: []model.Entry{*util.MakeEntry()}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = archive.Create(db); err != nil {
+		t.Fatal(err)
+	}
+	jobs = queue.NewMemoryQueue()
+	router := mux.NewRouter()
+	router.HandleFunc("/jobs", CreateJob).Methods("POST")
+	router.HandleFunc("/jobs/{id}", GetJob).Methods("GET")
+	request := func(method, path, body string) *httptest.ResponseRecorder {
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return resp
+	}
+
+	for body, expected := range map[string]int{
+		`{not json`:              400,
+		`{"archive_id": 999999}`: 404,
+		fmt.Sprintf(`{"archive_id": %d, "concurrency": 0}`, archive.ID):      400,
+		fmt.Sprintf(`{"archive_id": %d, "concurrency": -2}`, archive.ID):     400,
+		fmt.Sprintf(`{"archive_id": %d, "velocity": 0}`, archive.ID):         400,
+		fmt.Sprintf(`{"archive_id": %d, "velocity": -1.5}`, archive.ID):      400,
+		fmt.Sprintf(`{"archive_id": %d, "duration": "forever"}`, archive.ID): 400,
+	} {
+		if resp := request("POST", "/jobs", body); resp.Code != expected {
+			t.Errorf("Expected %s to be a %d, got %d: %s", body, expected, resp.Code, resp.Body.String())
+		}
+	}
+
+	resp := request("POST", "/jobs", fmt.Sprintf(`{"archive_id": %d}`, archive.ID))
+	if resp.Code != 200 {
+		t.Fatalf("Expected the job to be queued, got %d: %s", resp.Code, resp.Body.String())
+	}
+	created := struct{ ID string }{}
+	if err := json.Unmarshal(resp.Body.Bytes(), &created); err != nil {
+		t.Fatal(err)
+	}
+	if resp := request("GET", "/jobs/"+created.ID, ""); resp.Code != 200 {
+		t.Errorf("Expected the queued job to be found, got %d: %s", resp.Code, resp.Body.String())
+	}
+	if resp := request("GET", "/jobs/no-such-job", ""); resp.Code != 404 {
+		t.Errorf("Expected an unknown job to be not found, got: %d", resp.Code)
+	}
+}
+
+func TestStartHar(t *testing.T) {
+	var hits int32
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Injected") == "yes" {
+			atomic.AddInt32(&hits, 1)
+		}
+	}))
+	defer target.Close()
+
+	entry := util.MakeEntry()
+	entry.Request.Method = "GET"
+	har := &model.Har{Entries: []model.Entry{*entry}}
+	archive, err := persistence.MakeArchive("name", "description", har)
+	if err != nil {
+		t.Fatal(err)
+	}
+	archive.Target = target.URL
+	if err = archive.Create(db); err != nil {
+		t.Fatal(err)
+	}
+	transform, err := persistence.MakeTransformFor(archive.ID, transforms.HeaderInjectionTransform{Key: "X-Injected", Value: "yes"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = transform.Create(db); err != nil {
+		t.Fatal(err)
+	}
+
+	resp := httptest.NewRecorder()
+	body := fmt.Sprintf(`{"archive_id": %d, "concurrency": 2, "velocity": 10, "iterations": 3}`, archive.ID)
+	req, err := http.NewRequest("POST", "/start", bytes.NewBufferString(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	StartHar(resp, req)
+	if resp.Code != 200 {
+		t.Fatalf("Expected the run to start, got %d: %s", resp.Code, resp.Body.String())
+	}
+
+	started := struct {
+		ID string `json:"id"`
+	}{}
+	if err = json.Unmarshal(resp.Body.Bytes(), &started); err != nil {
+		t.Fatal(err)
+	}
+	group := runner.FindGroup(started.ID)
+	if group == nil {
+		t.Fatalf("Expected run %q to be findable", started.ID)
+	}
+	group.Wait()
+
+	if hits := atomic.LoadInt32(&hits); hits != 6 {
+		t.Errorf("Expected 2 sessions to replay the archive 3 times each, got %d transformed requests", hits)
+	}
+
+	resp = httptest.NewRecorder()
+	req = mux.SetURLVars(httptest.NewRequest("GET", "/runs/"+started.ID, nil), map[string]string{"id": started.ID})
+	GetRun(resp, req)
+	status := runner.GroupStatus{}
+	if err = json.Unmarshal(resp.Body.Bytes(), &status); err != nil {
+		t.Fatal(err)
+	}
+	if !status.Done || status.Summary.Requests != 6 {
+		t.Errorf("Expected the finished run to report 6 requests, got: %#v", status)
+	}
+
+	// The run's history is stored once it's done
+	var runs []persistence.Run
+	for i := 0; i < 50 && (len(runs) == 0 || runs[0].EndedAt == nil); i++ {
+		time.Sleep(10 * time.Millisecond)
+		if runs, err = db.ListRuns(archive.ID); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(runs) != 1 || runs[0].Requests != 6 || runs[0].RunID != started.ID {
+		t.Errorf("Expected the run to be stored in the history, got: %#v", runs)
+	}
+	if len(runs) == 0 {
+		return
+	}
+
+	id := strconv.FormatInt(runs[0].ID, 10)
+	resp = httptest.NewRecorder()
+	GetHistory(resp, mux.SetURLVars(httptest.NewRequest("GET", "/history/"+id, nil), map[string]string{"id": id}))
+	if resp.Code != 200 {
+		t.Errorf("Expected the stored run to be found, got %d: %s", resp.Code, resp.Body.String())
+	}
+	resp = httptest.NewRecorder()
+	GetHistory(resp, mux.SetURLVars(httptest.NewRequest("GET", "/history/999999", nil), map[string]string{"id": "999999"}))
+	if resp.Code != 404 {
+		t.Errorf("Expected an unknown run to be not found, got: %d", resp.Code)
+	}
+}
+
+func TestRunLifecycle(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer target.Close()
+
+	entry := util.MakeEntry()
+	entry.Request.Method = "GET"
+	entry.Request.URL = target.URL
+	entry.TimeMs = 60000 // wait a minute after the first request
+	group := runner.NewGroup(&model.Har{Entries: []model.Entry{*entry, *entry}}, 1, 1, 1.0)
+	if err := group.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	resp := httptest.NewRecorder()
+	req := mux.SetURLVars(httptest.NewRequest("POST", "/runs/"+group.ID+"/pause", nil), map[string]string{"id": group.ID, "operation": "pause"})
+	OperateRun(resp, req)
+	if resp.Code != 200 {
+		t.Fatalf("Expected the run to be paused, got %d: %s", resp.Code, resp.Body.String())
+	}
+
+	resp = httptest.NewRecorder()
+	ListRuns(resp, httptest.NewRequest("GET", "/runs?state=paused", nil))
+	statuses := []runner.GroupStatus{}
+	if err := json.Unmarshal(resp.Body.Bytes(), &statuses); err != nil {
+		t.Fatal(err)
+	}
+	if len(statuses) != 1 || statuses[0].ID != group.ID {
+		t.Errorf("Expected only the paused run to be listed, got: %#v", statuses)
+	}
+
+	resp = httptest.NewRecorder()
+	req = mux.SetURLVars(httptest.NewRequest("POST", "/runs/kill", nil), map[string]string{"operation": "kill"})
+	OperateRuns(resp, req)
+	group.Wait()
+	if state := group.Status().State; state != runner.GroupKilled {
+		t.Errorf("Expected every run to be killed, got: %s", state)
+	}
+}
+
+func TestStreamRun(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer target.Close()
+
+	entry := util.MakeEntry()
+	entry.Request.Method = "GET"
+	entry.Request.URL = target.URL
+	entry.TimeMs = 100
+	group := runner.NewGroup(&model.Har{Entries: []model.Entry{*entry, *entry}}, 2, 1, 1.0)
+	group.TickEvery = 20 * time.Millisecond
+
+	router := mux.NewRouter()
+	router.HandleFunc("/runs/{id}/stream", StreamRun)
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	if err := group.Start(); err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.Get(server.URL + "/runs/" + group.ID + "/stream")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if contentType := resp.Header.Get("Content-Type"); contentType != "text/event-stream" {
+		t.Errorf("Expected an event stream, got: %s", contentType)
+	}
+
+	// The stream ends when the run does
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	events := strings.Split(strings.TrimSpace(string(body)), "\n\n")
+	if len(events) < 2 {
+		t.Fatalf("Expected several events, got: %s", body)
+	}
+	tick := runner.Tick{}
+	if err := json.Unmarshal([]byte(strings.TrimPrefix(events[0], "data: ")), &tick); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(events[len(events)-1], "event: done\ndata: ") {
+		t.Errorf("Expected the last event to say the run is done, got: %s", events[len(events)-1])
+	}
+}
+
+func TestTransformCRUD(t *testing.T) {
+	archive := &persistence.Archive{Name: "with transforms"}
+	if err := archive.Create(db); err != nil {
+		t.Fatal(err)
+	}
+	router := mux.NewRouter()
+	router.HandleFunc("/archives/{id}/transforms", ListTransforms).Methods("GET")
+	router.HandleFunc("/archives/{id}/transforms", CreateTransform).Methods("POST")
+	router.HandleFunc("/archives/{id}/transforms/{transformID}", GetTransform).Methods("GET")
+	router.HandleFunc("/archives/{id}/transforms/{transformID}", UpdateTransform).Methods("PUT")
+	router.HandleFunc("/archives/{id}/transforms/{transformID}", DeleteTransform).Methods("DELETE")
+	path := fmt.Sprintf("/archives/%d/transforms", archive.ID)
+	request := func(method, path, body string) *httptest.ResponseRecorder {
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return resp
+	}
+
+	// Transforms that can't be performed are turned away
+	resp := request("POST", path, `{"type": "NoSuchTransform", "marshaled_json": "{}"}`)
+	if resp.Code != 400 {
+		t.Errorf("Expected an unknown type to be rejected, got %d: %s", resp.Code, resp.Body.String())
+	}
+	resp = request("POST", path, `{"type": "HeaderInjectionTransform", "marshaled_json": "{not json"}`)
+	if resp.Code != 400 {
+		t.Errorf("Expected bad settings to be rejected, got %d: %s", resp.Code, resp.Body.String())
+	}
+	if resp := request("POST", "/archives/999999/transforms", `{}`); resp.Code != 404 {
+		t.Errorf("Expected a missing archive to be not found, got: %d", resp.Code)
+	}
+
+	created := []persistence.Transform{}
+	for _, body := range []string{
+		`{"type": "HeaderInjectionTransform", "position": 2, "marshaled_json": "{\"key\": \"X-Second\", \"value\": \"2\"}"}`,
+		`{"type": "HeaderInjectionTransform", "position": 1, "marshaled_json": "{\"key\": \"X-First\", \"value\": \"1\"}"}`,
+	} {
+		resp := request("POST", path, body)
+		if resp.Code != 200 {
+			t.Fatalf("Expected the transform to be created, got %d: %s", resp.Code, resp.Body.String())
+		}
+		transform := persistence.Transform{}
+		if err := json.Unmarshal(resp.Body.Bytes(), &transform); err != nil {
+			t.Fatal(err)
+		}
+		if transform.ArchiveID != archive.ID {
+			t.Errorf("Expected the transform to belong to the archive in the path, got: %d", transform.ArchiveID)
+		}
+		created = append(created, transform)
+	}
+
+	listed := []persistence.Transform{}
+	if err := json.Unmarshal(request("GET", path, "").Body.Bytes(), &listed); err != nil {
+		t.Fatal(err)
+	}
+	if len(listed) != 2 || listed[0].ID != created[1].ID || listed[1].ID != created[0].ID {
+		t.Errorf("Expected the transforms in order of position, got: %#v", listed)
+	}
+
+	// Move the first one to the end
+	one := fmt.Sprintf("%s/%d", path, created[1].ID)
+	resp = request("PUT", one, `{"type": "HeaderInjectionTransform", "position": 3, "marshaled_json": "{\"key\": \"X-Last\", \"value\": \"3\"}"}`)
+	if resp.Code != 200 {
+		t.Fatalf("Expected the transform to be updated, got %d: %s", resp.Code, resp.Body.String())
+	}
+	if resp := request("PUT", one, `{"type": "NoSuchTransform"}`); resp.Code != 400 {
+		t.Errorf("Expected an invalid update to be rejected, got: %d", resp.Code)
+	}
+	stored, err := persistence.Transform{}.Get(db, created[1].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Position != 3 || !strings.Contains(stored.MarshaledJSON, "X-Last") || stored.ArchiveID != archive.ID {
+		t.Errorf("Expected the valid update to be stored, got: %#v", stored)
+	}
+
+	// Transforms are only found through their own archive
+	if resp := request("GET", fmt.Sprintf("/archives/%d/transforms/%d", archive.ID+1, created[1].ID), ""); resp.Code != 404 {
+		t.Errorf("Expected another archive's transform to be not found, got: %d", resp.Code)
+	}
+
+	if resp := request("DELETE", one, ""); resp.Code != 200 {
+		t.Errorf("Expected the transform to be deleted, got %d: %s", resp.Code, resp.Body.String())
+	}
+	if resp := request("GET", one, ""); resp.Code != 404 {
+		t.Errorf("Expected the deleted transform to be gone, got: %d", resp.Code)
+	}
+}
+
+func TestListTransformTypes(t *testing.T) {
+	resp := httptest.NewRecorder()
+	ListTransformTypes(resp, httptest.NewRequest("GET", "/transform-types", nil))
+	if resp.Code != 200 {
+		t.Fatalf("Expected the transform types, got %d: %s", resp.Code, resp.Body.String())
+	}
+	described := []struct {
+		Name   string                 `json:"name"`
+		Schema map[string]interface{} `json:"schema"`
+	}{}
+	if err := json.Unmarshal(resp.Body.Bytes(), &described); err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for _, transformType := range described {
+		if transformType.Name == "HeaderInjectionTransform" && transformType.Schema["properties"] != nil {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("Expected HeaderInjectionTransform to be described, got: %s", resp.Body.String())
+	}
+}
+
+func TestListCorrelations(t *testing.T) {
+	login := &model.Response{Status: 200}
+	login.Content.Text = `{"token": "abc123XYZ"}`
+	har := &model.Har{Entries: []model.Entry{
+		{Request: &model.Request{Method: "POST", URL: "https://example.com/login"}, Response: login},
+		{Request: &model.Request{Method: "GET", URL: "https://example.com/me?token=abc123XYZ"}, Response: &model.Response{Status: 200}},
+	}}
+	source, err := parser.HarToJSON(har)
+	if err != nil {
+		t.Fatal(err)
+	}
+	archive := &persistence.Archive{Name: "with a token", Source: source}
+	if err := archive.Create(db); err != nil {
+		t.Fatal(err)
+	}
+	router := mux.NewRouter()
+	router.HandleFunc("/archives/{id}/correlations", ListCorrelations).Methods("GET")
+
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, httptest.NewRequest("GET", fmt.Sprintf("/archives/%d/correlations", archive.ID), nil))
+	if resp.Code != 200 {
+		t.Fatalf("Expected suggestions, got %d: %s", resp.Code, resp.Body.String())
+	}
+	suggestions := []correlation.Suggestion{}
+	if err := json.Unmarshal(resp.Body.Bytes(), &suggestions); err != nil {
+		t.Fatal(err)
+	}
+	if len(suggestions) != 1 || suggestions[0].Name != "$.token" || suggestions[0].Transform.ArchiveID != archive.ID {
+		t.Errorf("Expected the token to be suggested for the archive, got: %s", resp.Body.String())
+	}
+
+	resp = httptest.NewRecorder()
+	router.ServeHTTP(resp, httptest.NewRequest("GET", "/archives/999999/correlations", nil))
+	if resp.Code != 404 {
+		t.Errorf("Expected a missing archive to be not found, got: %d", resp.Code)
+	}
+}
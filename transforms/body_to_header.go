@@ -34,6 +34,20 @@ type BodyToHeaderTransform struct {
 	After      string `json:"after"`       // What to put into the header value after the match
 }
 
+func init() {
+	Register(Type{
+		Name:        "BodyToHeaderTransform",
+		Description: "Finds a value in a response body and sends it in a header of every request after that",
+		Fields: []Field{
+			{Name: "pattern", Type: "string", Required: true, Description: "a regular expression, the first group (or the whole match) is the value"},
+			{Name: "header_name", Type: "string", Required: true, Description: "which header to put the value into"},
+			{Name: "before", Type: "string", Description: "what to put into the header before the value"},
+			{Name: "after", Type: "string", Description: "what to put into the header after the value"},
+		},
+		New: func() RequestTransform { return &BodyToHeaderTransform{} },
+	})
+}
+
 // T is because I don't know how to inherit from a func
 func (t BodyToHeaderTransform) T(r *model.Request) ResponseTransform {
 	regex := regexp.MustCompile(t.Pattern)
@@ -0,0 +1,292 @@
+package transforms
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/JackDanger/traffic/model"
+)
+
+// ResponseCaptureTransform finds a value, like the ID of a just-created
+// order, in the response to a request and then replaces the value that was
+// recorded in its place wherever it appears in later requests: in URLs like
+// /orders/{id}, query strings, headers, cookies and bodies. That's how a
+// replay goes on to use the objects it created itself rather than the ones
+// that were created when the HAR was recorded.
+//
+// The value is found in both the live response and the recorded one, by a
+// JSONPath in the body, a regular expression in the body, or in a header (the
+// whole value, or the Pattern's first group within it). Only responses to
+// requests with the given Method are read, if it's set, since GET /orders
+// doesn't answer with the order that POST /orders does. Recorded values are
+// only replaced where they stand on their own so that capturing an ID of 12
+// doesn't change 123.
+//
+// Every matching response is read, so a request that's recorded creating
+// several orders replaces each of their IDs with the one created live. If
+// Variable is set the live value is also stored in the session.
+//
+// Example:
+//
+//   Given a recorded response to POST https://api.example.com/orders of:
+//     {"order": {"id": 1001}}
+//
+//   And a live response of:
+//     {"order": {"id": 2002}}
+//
+//   And a transform defined as:
+//     ResponseCaptureTransform{
+//       Method:     "POST",
+//       URLPattern: "/orders$",
+//       Path:       "$.order.id",
+//     }
+//
+//   Then the recorded request GET https://api.example.com/orders/1001 is
+//   sent as GET https://api.example.com/orders/2002.
+type ResponseCaptureTransform struct {
+	Method       string `json:"method"`      // blank matches every method
+	URLPattern   string `json:"url_pattern"` // a regular expression, blank matches every request
+	Path         string `json:"path"`        // a JSONPath in the response body
+	Pattern      string `json:"pattern"`     // a regular expression whose first group (or whole match) is the value
+	Header       string `json:"header"`      // the response header to find the value in instead of the body
+	Variable     string `json:"variable"`    // a session variable to also store the live value in
+	replacements []replacement
+	session      *Session
+}
+
+// replacement is a recorded value and the live value that takes its place
+type replacement struct {
+	recorded string
+	live     string
+}
+
+var _ SessionTransform = &ResponseCaptureTransform{}
+
+func init() {
+	Register(Type{
+		Name:        "ResponseCaptureTransform",
+		Description: "Finds a value in a response and replaces the recorded value with it wherever it appears in later requests",
+		Fields: []Field{
+			{Name: "method", Type: "string", Description: "only responses to requests with this method are read, blank for any"},
+			{Name: "url_pattern", Type: "string", Description: "a regular expression, only responses to requests with matching URLs are read"},
+			{Name: "path", Type: "string", Description: "a JSONPath to the value in the response body"},
+			{Name: "pattern", Type: "string", Description: "a regular expression to find the value with, the first group (or the whole match) is the value"},
+			{Name: "header", Type: "string", Description: "the response header to find the value in, instead of the body"},
+			{Name: "variable", Type: "string", Description: "the name of a session variable to also store the value in"},
+		},
+		New: func() RequestTransform { return &ResponseCaptureTransform{} },
+	})
+}
+
+// UseSession is where mistakes are reported and the value may be stored
+func (t *ResponseCaptureTransform) UseSession(session *Session) {
+	t.session = session
+}
+
+// T is because I don't know how to inherit from a func
+func (t *ResponseCaptureTransform) T(r *model.Request) ResponseTransform {
+	if t.session == nil {
+		t.session = NewSession()
+	}
+	t.replaceRecorded(r)
+
+	matched, err := regexp.MatchString(t.URLPattern, r.URL)
+	if err != nil {
+		t.session.Fail(fmt.Errorf("ResponseCaptureTransform: bad url_pattern: %s", err))
+		return passthrough{requestTransform: t}
+	}
+	if !matched || (t.Method != "" && !strings.EqualFold(t.Method, r.Method)) {
+		return passthrough{requestTransform: t}
+	}
+	return &capture{transform: t, url: r.URL}
+}
+
+// capture compares the value in the live response with the recorded one
+type capture struct {
+	transform *ResponseCaptureTransform
+	url       string
+	recorded  *model.Response
+}
+
+var _ RecordedResponseTransform = &capture{}
+
+func (c *capture) Recorded(response *model.Response) {
+	c.recorded = response
+}
+
+func (c *capture) T(response *model.Response) RequestTransform {
+	t := c.transform
+	live, err := t.extract(response)
+	if err != nil {
+		t.session.Fail(fmt.Errorf("ResponseCaptureTransform %s from %s: %s", t.describe(), c.url, err))
+		return t
+	}
+	if t.Variable != "" {
+		t.session.Set(t.Variable, live)
+	}
+	if c.recorded == nil {
+		return t
+	}
+	recorded, err := t.extract(c.recorded)
+	if err != nil || recorded == "" || recorded == live {
+		// Nothing was recorded that needs replacing
+		return t
+	}
+	for i, existing := range t.replacements {
+		if existing.recorded == recorded {
+			t.replacements[i].live = live
+			return t
+		}
+	}
+	t.replacements = append(t.replacements, replacement{recorded: recorded, live: live})
+	return t
+}
+
+// replaceRecorded puts the live values in place of the recorded ones
+// throughout the request
+func (t *ResponseCaptureTransform) replaceRecorded(r *model.Request) {
+	if len(t.replacements) == 0 {
+		return
+	}
+	rewriteRequest(r, func(text string) string {
+		for _, each := range t.replacements {
+			text = ReplaceWhole(text, each.recorded, each.live)
+			if escaped := url.QueryEscape(each.recorded); escaped != each.recorded {
+				text = ReplaceWhole(text, escaped, url.QueryEscape(each.live))
+			}
+		}
+		return text
+	})
+}
+
+// extract finds the value in a response. When there are several headers of
+// the same name, like Set-Cookie, it's the first one the value's found in.
+func (t *ResponseCaptureTransform) extract(response *model.Response) (string, error) {
+	texts := []string{response.Body()}
+	if t.Header != "" {
+		texts = nil
+		for _, header := range response.Headers {
+			if header.Key != nil && header.Value != nil && strings.EqualFold(*header.Key, t.Header) {
+				texts = append(texts, *header.Value)
+			}
+		}
+		if len(texts) == 0 {
+			return "", fmt.Errorf("no %s header in the response", t.Header)
+		}
+	}
+
+	var err error
+	for _, text := range texts {
+		var value string
+		if value, err = t.find(text); err == nil {
+			return value, nil
+		}
+	}
+	return "", err
+}
+
+// find is the value in a body or header
+func (t *ResponseCaptureTransform) find(text string) (string, error) {
+	switch {
+	case t.Path != "":
+		path, err := ParseJSONPath(t.Path)
+		if err != nil {
+			return "", err
+		}
+		document, err := DecodeJSON(text)
+		if err != nil {
+			return "", fmt.Errorf("the response isn't JSON: %s", err)
+		}
+		found := path.Find(document)
+		if len(found) == 0 {
+			return "", errors.New("no such path in the response")
+		}
+		return JSONValueString(found[0]), nil
+	case t.Pattern != "":
+		pattern, err := regexp.Compile(t.Pattern)
+		if err != nil {
+			return "", fmt.Errorf("bad pattern: %s", err)
+		}
+		match := pattern.FindStringSubmatch(text)
+		if match == nil {
+			return "", errors.New("no match in the response")
+		}
+		if len(match) > 1 {
+			return match[1], nil
+		}
+		return match[0], nil
+	case t.Header != "":
+		return text, nil
+	}
+	return "", errors.New("a path, pattern or header is needed to find the value")
+}
+
+// describe is how the value is found, for error messages
+func (t *ResponseCaptureTransform) describe() string {
+	switch {
+	case t.Path != "":
+		return t.Path
+	case t.Pattern != "" && t.Header != "":
+		return t.Header + " " + t.Pattern
+	case t.Pattern != "":
+		return t.Pattern
+	}
+	return t.Header
+}
+
+// ContainsWhole says whether the value is in the text somewhere that it isn't
+// just part of a longer word or number
+func ContainsWhole(text, value string) bool {
+	if value == "" {
+		return false
+	}
+	for offset := 0; ; offset++ {
+		i := strings.Index(text[offset:], value)
+		if i < 0 {
+			return false
+		}
+		offset += i
+		if standsAlone(text, offset, value) {
+			return true
+		}
+	}
+}
+
+// ReplaceWhole replaces every instance of the recorded value in the text
+// that isn't part of a longer word or number
+func ReplaceWhole(text, recorded, live string) string {
+	if recorded == "" || !strings.Contains(text, recorded) {
+		return text
+	}
+	result := strings.Builder{}
+	for {
+		i := strings.Index(text, recorded)
+		if i < 0 {
+			result.WriteString(text)
+			return result.String()
+		}
+		if !standsAlone(text, i, recorded) {
+			result.WriteString(text[:i+1])
+			text = text[i+1:]
+			continue
+		}
+		result.WriteString(text[:i])
+		result.WriteString(live)
+		text = text[i+len(recorded):]
+	}
+}
+
+// standsAlone says whether the value found at start in the text isn't
+// joined to a word or number on either side
+func standsAlone(text string, start int, value string) bool {
+	end := start + len(value)
+	return !(start > 0 && isWordByte(text[start-1]) && isWordByte(value[0])) &&
+		!(end < len(text) && isWordByte(text[end]) && isWordByte(value[len(value)-1]))
+}
+
+func isWordByte(b byte) bool {
+	return b == '_' || b >= '0' && b <= '9' || b >= 'a' && b <= 'z' || b >= 'A' && b <= 'Z'
+}
@@ -16,6 +16,18 @@ type ConstantTransform struct {
 	compiledSearch *regexp.Regexp
 }
 
+func init() {
+	Register(Type{
+		Name:        "ConstantTransform",
+		Description: "Replaces a constant wherever it appears in the URL, headers, cookies and query string",
+		Fields: []Field{
+			{Name: "search", Type: "string", Required: true, Description: "a regular expression to find"},
+			{Name: "replace", Type: "string", Required: true, Description: "what to replace it with"},
+		},
+		New: func() RequestTransform { return &ConstantTransform{} },
+	})
+}
+
 // T is because I don't know how to inherit from a func
 func (t *ConstantTransform) T(r *model.Request) ResponseTransform {
 	// We replace constants when they appear as string values anywhere in the
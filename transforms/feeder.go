@@ -0,0 +1,291 @@
+package transforms
+
+import (
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/JackDanger/traffic/model"
+)
+
+// FeederTransform gives each session its own row of a CSV or JSONL file, e.g.
+// a list of test accounts, so that concurrent sessions don't all replay the
+// same credentials. The row's columns become session variables for requests
+// to use as {{column}}, or {{prefix.column}} if there's a Prefix.
+//
+// Mode decides which row a session gets:
+//
+//	circular  the next row, starting over from the first after the last (the default)
+//	random    any row, possibly one another session has too
+//	unique    the next row, and no session gets it after that. Once they're
+//	          all used up every new session fails.
+//
+// Every session of a run takes its rows from the same Feeder, handed to the
+// transform by UseFeeders.
+//
+// Example:
+//
+//	Given users.csv:
+//	  email,password
+//	  one@example.com,secret1
+//	  two@example.com,secret2
+//
+//	And a transform defined as:
+//	  FeederTransform{File: "users.csv", Mode: "unique"}
+//
+//	The first session logs in with a body of
+//	  {"email": "{{email}}", "password": "{{password}}"}
+//	as one@example.com and the second as two@example.com.
+type FeederTransform struct {
+	File    string `json:"file"`
+	Format  string `json:"format"` // csv or jsonl, guessed from the File's extension if it's blank
+	Mode    string `json:"mode"`   // circular, random or unique
+	Prefix  string `json:"prefix"` // put in front of each column's name, e.g. "user."
+	feeder  *Feeder
+	fed     bool
+	session *Session
+}
+
+var _ SessionTransform = &FeederTransform{}
+
+func init() {
+	Register(Type{
+		Name:        "FeederTransform",
+		Description: "Gives each session a row of a CSV or JSONL file as variables",
+		Fields: []Field{
+			{Name: "file", Type: "string", Required: true, Description: "the path of a CSV file with a header row or a file of JSON objects, one per line"},
+			{Name: "format", Type: "string", Description: "csv or jsonl, guessed from the file's extension if it's blank"},
+			{Name: "mode", Type: "string", Description: "circular (the default), random, or unique to use each row only once"},
+			{Name: "prefix", Type: "string", Description: "put in front of each column's name to make the variable's name"},
+		},
+		New: func() RequestTransform { return &FeederTransform{} },
+	})
+}
+
+// UseSession is where the row's values are stored
+func (t *FeederTransform) UseSession(session *Session) {
+	t.session = session
+}
+
+// UseFeeder sets where rows come from
+func (t *FeederTransform) UseFeeder(feeder *Feeder) {
+	t.feeder = feeder
+}
+
+// T is because I don't know how to inherit from a func
+func (t *FeederTransform) T(r *model.Request) ResponseTransform {
+	if t.session == nil {
+		t.session = NewSession()
+	}
+	if !t.fed {
+		// Only the first request takes a row, the rest of the session uses it
+		t.fed = true
+		if err := t.feed(); err != nil {
+			t.session.Fail(fmt.Errorf("FeederTransform %s: %s", t.File, err))
+		}
+	}
+	return passthrough{requestTransform: t}
+}
+
+func (t *FeederTransform) feed() error {
+	if t.feeder == nil {
+		// Nobody shared a feeder with this transform so it has one of its own
+		feeder, err := NewFeeders().Open(t.File, t.Format, t.Mode)
+		if err != nil {
+			return err
+		}
+		t.feeder = feeder
+	}
+	row, err := t.feeder.Next()
+	if err != nil {
+		return err
+	}
+	for column, value := range row {
+		t.session.Set(t.Prefix+column, value)
+	}
+	return nil
+}
+
+// Feeder hands out the rows of a file to sessions
+type Feeder struct {
+	Mode string
+	rows []map[string]string
+	next int
+	m    sync.Mutex
+}
+
+// The modes a Feeder can hand out rows in
+const (
+	FeedCircular = "circular"
+	FeedRandom   = "random"
+	FeedUnique   = "unique"
+)
+
+// ErrFeederExhausted is what a unique Feeder says when every row's been used
+var ErrFeederExhausted = errors.New("every row has been used")
+
+// NewFeeder hands out the rows in the given mode
+func NewFeeder(rows []map[string]string, mode string) (*Feeder, error) {
+	if mode == "" {
+		mode = FeedCircular
+	}
+	if mode != FeedCircular && mode != FeedRandom && mode != FeedUnique {
+		return nil, fmt.Errorf("unknown mode %q, expected circular, random or unique", mode)
+	}
+	if len(rows) == 0 {
+		return nil, errors.New("there are no rows")
+	}
+	return &Feeder{Mode: mode, rows: rows}, nil
+}
+
+// Next is the row for a new session
+func (f *Feeder) Next() (map[string]string, error) {
+	f.m.Lock()
+	defer f.m.Unlock()
+	switch f.Mode {
+	case FeedRandom:
+		return f.rows[rand.Intn(len(f.rows))], nil
+	case FeedUnique:
+		if f.next >= len(f.rows) {
+			return nil, ErrFeederExhausted
+		}
+	}
+	row := f.rows[f.next%len(f.rows)]
+	f.next++
+	return row, nil
+}
+
+// Feeders are the feeders for one run, opened once for all of its sessions
+// to share
+type Feeders struct {
+	feeders map[string]*Feeder
+	m       sync.Mutex
+}
+
+// NewFeeders starts a run without any open feeders
+func NewFeeders() *Feeders {
+	return &Feeders{feeders: map[string]*Feeder{}}
+}
+
+// Open reads the file the first time it's asked for and shares its Feeder
+// after that
+func (f *Feeders) Open(file, format, mode string) (*Feeder, error) {
+	key := strings.Join([]string{file, format, mode}, "\x00")
+	f.m.Lock()
+	defer f.m.Unlock()
+	if feeder, ok := f.feeders[key]; ok {
+		return feeder, nil
+	}
+	rows, err := ReadRows(file, format)
+	if err != nil {
+		return nil, err
+	}
+	feeder, err := NewFeeder(rows, mode)
+	if err != nil {
+		return nil, err
+	}
+	f.feeders[key] = feeder
+	return feeder, nil
+}
+
+// UseFeeders hands every FeederTransform its shared Feeder, reading files as
+// needed so that a missing or broken one is found before anything's sent
+func UseFeeders(feeders *Feeders, requestTransforms []RequestTransform) error {
+	for _, transform := range requestTransforms {
+		t, ok := transform.(*FeederTransform)
+		if !ok {
+			continue
+		}
+		feeder, err := feeders.Open(t.File, t.Format, t.Mode)
+		if err != nil {
+			return fmt.Errorf("FeederTransform %s: %s", t.File, err)
+		}
+		t.UseFeeder(feeder)
+	}
+	return nil
+}
+
+// ReadRows reads every row of a CSV file, whose first row names the columns,
+// or of a JSONL file with an object on each line
+func ReadRows(file, format string) ([]map[string]string, error) {
+	if format == "" {
+		switch strings.ToLower(filepath.Ext(file)) {
+		case ".jsonl", ".ndjson":
+			format = "jsonl"
+		default:
+			format = "csv"
+		}
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	switch format {
+	case "csv":
+		return readCSV(f)
+	case "jsonl":
+		return readJSONL(f)
+	}
+	return nil, fmt.Errorf("unknown format %q, expected csv or jsonl", format)
+}
+
+func readCSV(in io.Reader) ([]map[string]string, error) {
+	reader := csv.NewReader(in)
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	rows := []map[string]string{}
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return rows, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		row := map[string]string{}
+		for i, column := range header {
+			row[strings.TrimSpace(column)] = record[i]
+		}
+		rows = append(rows, row)
+	}
+}
+
+func readJSONL(in io.Reader) ([]map[string]string, error) {
+	rows := []map[string]string{}
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		document, err := DecodeJSON(text)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", line, err)
+		}
+		object, ok := document.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected an object", line)
+		}
+		row := map[string]string{}
+		for column, value := range object {
+			row[column] = JSONValueString(value)
+		}
+		rows = append(rows, row)
+	}
+	return rows, scanner.Err()
+}
@@ -0,0 +1,123 @@
+package transforms
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/JackDanger/traffic/util"
+)
+
+func writeFeederFile(t *testing.T, name, contents string) string {
+	dir, err := ioutil.TempDir("", "feeder")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, []byte(contents), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestReadRows(t *testing.T) {
+	csvFile := writeFeederFile(t, "users.csv", "email,password\none@example.com,secret1\ntwo@example.com,\"se,cret2\"\n")
+	defer os.RemoveAll(filepath.Dir(csvFile))
+	rows, err := ReadRows(csvFile, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 2 || rows[0]["email"] != "one@example.com" || rows[1]["password"] != "se,cret2" {
+		t.Errorf("Expected a row per line named by the header, got: %v", rows)
+	}
+
+	jsonlFile := writeFeederFile(t, "users.jsonl", "{\"email\": \"one@example.com\", \"id\": 12345678901234567890}\n\n{\"email\": \"two@example.com\"}\n")
+	defer os.RemoveAll(filepath.Dir(jsonlFile))
+	rows, err = ReadRows(jsonlFile, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 2 || rows[0]["id"] != "12345678901234567890" || rows[1]["email"] != "two@example.com" {
+		t.Errorf("Expected a row per JSON object, got: %v", rows)
+	}
+
+	badFile := writeFeederFile(t, "bad.jsonl", "{\"email\": \"one@example.com\"}\n[1, 2]\n")
+	defer os.RemoveAll(filepath.Dir(badFile))
+	if _, err := ReadRows(badFile, ""); err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("Expected an error naming the bad line, got: %v", err)
+	}
+}
+
+func TestFeederModes(t *testing.T) {
+	rows := []map[string]string{{"n": "1"}, {"n": "2"}}
+	next := func(feeder *Feeder) string {
+		row, err := feeder.Next()
+		if err != nil {
+			return err.Error()
+		}
+		return row["n"]
+	}
+
+	circular, _ := NewFeeder(rows, "")
+	got := []string{next(circular), next(circular), next(circular)}
+	if strings.Join(got, ",") != "1,2,1" {
+		t.Errorf("Expected circular rows to start over, got: %v", got)
+	}
+
+	unique, _ := NewFeeder(rows, FeedUnique)
+	got = []string{next(unique), next(unique), next(unique)}
+	if strings.Join(got, ",") != "1,2,"+ErrFeederExhausted.Error() {
+		t.Errorf("Expected unique rows to run out, got: %v", got)
+	}
+
+	random, _ := NewFeeder(rows, FeedRandom)
+	for i := 0; i < 10; i++ {
+		if n := next(random); n != "1" && n != "2" {
+			t.Fatalf("Expected one of the rows, got: %s", n)
+		}
+	}
+
+	if _, err := NewFeeder(rows, "sideways"); err == nil {
+		t.Error("Expected an unknown mode to be rejected")
+	}
+}
+
+func TestFeederTransformGivesEachSessionItsOwnRow(t *testing.T) {
+	file := writeFeederFile(t, "users.csv", "email,password\none@example.com,secret1\ntwo@example.com,secret2\n")
+	defer os.RemoveAll(filepath.Dir(file))
+	feeders := NewFeeders()
+
+	emails := []string{}
+	for i := 0; i < 3; i++ {
+		transform := &FeederTransform{File: file, Mode: FeedUnique, Prefix: "user."}
+		if err := UseFeeders(feeders, []RequestTransform{transform}); err != nil {
+			t.Fatal(err)
+		}
+		session := NewSession()
+		transform.UseSession(session)
+
+		request := util.MakeRequest()
+		request.URL = "https://example.com/login?email={{user.email}}"
+		transform.T(request)
+		transform.T(util.MakeRequest())
+		session.RenderRequest(request)
+
+		if i < 2 {
+			emails = append(emails, request.URL)
+			if errs := session.Errors(); len(errs) != 0 {
+				t.Errorf("Expected no errors, got: %v", errs)
+			}
+		} else if errs := session.Errors(); len(errs) == 0 || !strings.Contains(errs[0].Error(), ErrFeederExhausted.Error()) {
+			t.Errorf("Expected the third session to run out of rows, got: %v", errs)
+		}
+	}
+	if strings.Join(emails, " ") != "https://example.com/login?email=one@example.com https://example.com/login?email=two@example.com" {
+		t.Errorf("Expected each session to get a row, got: %v", emails)
+	}
+
+	if err := UseFeeders(feeders, []RequestTransform{&FeederTransform{File: file + ".missing"}}); err == nil {
+		t.Error("Expected a missing file to be reported")
+	}
+}
@@ -0,0 +1,304 @@
+package transforms
+
+import (
+	"fmt"
+	"math/rand"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/JackDanger/traffic/model"
+	"github.com/JackDanger/traffic/util"
+)
+
+// The generators replace a token wherever it appears in a request (its URL,
+// query string, headers, cookies and body) with a value made up at the time
+// it's sent. Concurrent sessions each get their own values so that they
+// create distinct objects instead of all saving the one that was recorded.
+
+// GUIDTransform replaces tokens like GUID1 and GUID4 with GUIDs. Each token
+// gets its own GUID that stays the same for the rest of the session, so an
+// object created as GUID1 can be fetched as GUID1 later on. The GUIDs are
+// also session variables, named after their tokens.
+type GUIDTransform struct {
+	Pattern  string `json:"pattern"` // a regular expression, GUID followed by digits if it's blank
+	compiled *regexp.Regexp
+	session  *Session
+}
+
+// TimestampTransform replaces a token with the time the request is sent.
+// Format is "unix" (the default), "unix_ms", "iso8601" or a Go time layout.
+type TimestampTransform struct {
+	Token  string `json:"token"`
+	Format string `json:"format"`
+}
+
+// RandomIntTransform replaces a token with a random integer between Min and
+// Max, inclusive. It's the same number everywhere in one request and a new
+// one for the next.
+type RandomIntTransform struct {
+	Token string `json:"token"`
+	Min   int64  `json:"min"`
+	Max   int64  `json:"max"`
+}
+
+// RandomStringTransform replaces a token with a random string of Length
+// characters taken from Characters. It's the same string everywhere in one
+// request and a new one for the next.
+type RandomStringTransform struct {
+	Token      string `json:"token"`
+	Length     int    `json:"length"`     // 16 if it's not set
+	Characters string `json:"characters"` // letters and digits if it's blank
+}
+
+// CounterTransform replaces a token with a number that goes up by Step
+// (1 if it's not set) each time a request uses it, starting from Start.
+// Sessions that share Counters (see UseCounters) share the count too, so
+// no two requests get the same number.
+type CounterTransform struct {
+	Token   string `json:"token"`
+	Start   int64  `json:"start"`
+	Step    int64  `json:"step"`
+	counter *Counter
+}
+
+// Counter is a number that's safe to count up from multiple goroutines
+type Counter struct {
+	next int64
+}
+
+// Counters are every Counter in a run, one per token
+type Counters struct {
+	counters map[string]*Counter
+	m        sync.Mutex
+}
+
+var (
+	_ SessionTransform = &GUIDTransform{}
+	_ RequestTransform = &TimestampTransform{}
+	_ RequestTransform = &RandomIntTransform{}
+	_ RequestTransform = &RandomStringTransform{}
+	_ RequestTransform = &CounterTransform{}
+)
+
+const (
+	defaultGUIDPattern      = `GUID\d+`
+	defaultRandomLength     = 16
+	defaultRandomCharacters = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+)
+
+func init() {
+	token := Field{Name: "token", Type: "string", Required: true, Description: "the text to replace, e.g. UNIXTIME"}
+	Register(Type{
+		Name:        "GUIDTransform",
+		Description: "Replaces tokens like GUID1 with a GUID that stays the same for the whole session",
+		Fields: []Field{
+			{Name: "pattern", Type: "string", Description: `a regular expression for the tokens, GUID\d+ if it's blank`},
+		},
+		New: func() RequestTransform { return &GUIDTransform{} },
+	})
+	Register(Type{
+		Name:        "TimestampTransform",
+		Description: "Replaces a token with the time the request is sent",
+		Fields: []Field{
+			token,
+			{Name: "format", Type: "string", Description: "unix (the default), unix_ms, iso8601 or a Go time layout"},
+		},
+		New: func() RequestTransform { return &TimestampTransform{} },
+	})
+	Register(Type{
+		Name:        "RandomIntTransform",
+		Description: "Replaces a token with a random integer, new for every request",
+		Fields: []Field{
+			token,
+			{Name: "min", Type: "integer", Description: "the smallest it can be"},
+			{Name: "max", Type: "integer", Required: true, Description: "the largest it can be"},
+		},
+		New: func() RequestTransform { return &RandomIntTransform{} },
+	})
+	Register(Type{
+		Name:        "RandomStringTransform",
+		Description: "Replaces a token with a random string, new for every request",
+		Fields: []Field{
+			token,
+			{Name: "length", Type: "integer", Description: "how many characters, 16 if it's not set"},
+			{Name: "characters", Type: "string", Description: "the characters to choose from, letters and digits if it's blank"},
+		},
+		New: func() RequestTransform { return &RandomStringTransform{} },
+	})
+	Register(Type{
+		Name:        "CounterTransform",
+		Description: "Replaces a token with a number that goes up with every request that uses it",
+		Fields: []Field{
+			token,
+			{Name: "start", Type: "integer", Description: "the first number"},
+			{Name: "step", Type: "integer", Description: "how much it goes up by, 1 if it's not set"},
+		},
+		New: func() RequestTransform { return &CounterTransform{} },
+	})
+}
+
+// UseSession is where the GUIDs are kept
+func (t *GUIDTransform) UseSession(session *Session) {
+	t.session = session
+}
+
+// T is because I don't know how to inherit from a func
+func (t *GUIDTransform) T(r *model.Request) ResponseTransform {
+	if t.session == nil {
+		t.session = NewSession()
+	}
+	if t.compiled == nil {
+		pattern := t.Pattern
+		if pattern == "" {
+			pattern = defaultGUIDPattern
+		}
+		compiled, err := regexp.Compile(pattern)
+		if err != nil {
+			t.session.Fail(fmt.Errorf("GUIDTransform: bad pattern: %s", err))
+			return passthrough{requestTransform: t}
+		}
+		t.compiled = compiled
+	}
+
+	rewriteRequest(r, func(text string) string {
+		return t.compiled.ReplaceAllStringFunc(text, t.guidFor)
+	})
+	return passthrough{requestTransform: t}
+}
+
+// guidFor is the session's GUID for a token, made up the first time it's seen
+func (t *GUIDTransform) guidFor(token string) string {
+	if guid, ok := t.session.Get(token); ok {
+		return guid
+	}
+	guid := util.UUID()
+	t.session.Set(token, guid)
+	return guid
+}
+
+// T is because I don't know how to inherit from a func
+func (t *TimestampTransform) T(r *model.Request) ResponseTransform {
+	now := time.Now()
+	var value string
+	switch t.Format {
+	case "", "unix":
+		value = strconv.FormatInt(now.Unix(), 10)
+	case "unix_ms":
+		value = strconv.FormatInt(now.UnixNano()/int64(time.Millisecond), 10)
+	case "iso8601":
+		value = now.UTC().Format(time.RFC3339)
+	default:
+		value = now.Format(t.Format)
+	}
+	replaceToken(r, t.Token, value)
+	return passthrough{requestTransform: t}
+}
+
+// T is because I don't know how to inherit from a func
+func (t *RandomIntTransform) T(r *model.Request) ResponseTransform {
+	value := t.Min
+	if t.Max > t.Min {
+		value += rand.Int63n(t.Max - t.Min + 1)
+	}
+	replaceToken(r, t.Token, strconv.FormatInt(value, 10))
+	return passthrough{requestTransform: t}
+}
+
+// T is because I don't know how to inherit from a func
+func (t *RandomStringTransform) T(r *model.Request) ResponseTransform {
+	length, characters := t.Length, []rune(t.Characters)
+	if length <= 0 {
+		length = defaultRandomLength
+	}
+	if len(characters) == 0 {
+		characters = []rune(defaultRandomCharacters)
+	}
+	value := make([]rune, length)
+	for i := range value {
+		value[i] = characters[rand.Intn(len(characters))]
+	}
+	replaceToken(r, t.Token, string(value))
+	return passthrough{requestTransform: t}
+}
+
+// T is because I don't know how to inherit from a func
+func (t *CounterTransform) T(r *model.Request) ResponseTransform {
+	if !requestContains(r, t.Token) {
+		return passthrough{requestTransform: t}
+	}
+	if t.counter == nil {
+		t.counter = NewCounter(t.Start)
+	}
+	step := t.Step
+	if step == 0 {
+		step = 1
+	}
+	replaceToken(r, t.Token, strconv.FormatInt(t.counter.Next(step), 10))
+	return passthrough{requestTransform: t}
+}
+
+// UseCounter is where the numbers come from, the transform counts on its own
+// if it's never given one
+func (t *CounterTransform) UseCounter(counter *Counter) {
+	t.counter = counter
+}
+
+// NewCounter starts counting at the given number
+func NewCounter(start int64) *Counter {
+	return &Counter{next: start}
+}
+
+// Next is the current number, and moves the count on by step
+func (c *Counter) Next(step int64) int64 {
+	return atomic.AddInt64(&c.next, step) - step
+}
+
+// NewCounters starts a run without any counters
+func NewCounters() *Counters {
+	return &Counters{counters: map[string]*Counter{}}
+}
+
+// Counter is the token's Counter, starting at start the first time it's
+// asked for
+func (c *Counters) Counter(token string, start int64) *Counter {
+	c.m.Lock()
+	defer c.m.Unlock()
+	if counter, ok := c.counters[token]; ok {
+		return counter
+	}
+	counter := NewCounter(start)
+	c.counters[token] = counter
+	return counter
+}
+
+// UseCounters hands every CounterTransform the shared Counter for its token
+func UseCounters(counters *Counters, requestTransforms []RequestTransform) {
+	for _, transform := range requestTransforms {
+		if t, ok := transform.(*CounterTransform); ok {
+			t.UseCounter(counters.Counter(t.Token, t.Start))
+		}
+	}
+}
+
+// replaceToken replaces every instance of the token throughout the request
+func replaceToken(r *model.Request, token, value string) {
+	if token == "" {
+		return
+	}
+	rewriteRequest(r, func(text string) string {
+		return strings.Replace(text, token, value, -1)
+	})
+}
+
+// requestContains says whether the token appears anywhere in the request
+func requestContains(r *model.Request, token string) bool {
+	found := false
+	eachString(r, func(text *string) {
+		found = found || (token != "" && strings.Contains(*text, token))
+	})
+	return found
+}
@@ -0,0 +1,121 @@
+package transforms
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/JackDanger/traffic/model"
+	"github.com/JackDanger/traffic/util"
+)
+
+func requestWithToken(token string) *model.Request {
+	r := util.MakeRequest()
+	r.URL = "https://example.com/things/" + token
+	r.Headers = append(r.Headers, model.SingleItemMap{Key: util.StringPtr("X-Thing"), Value: util.StringPtr(token)})
+	r.PostData = &model.PostData{MimeType: "application/json", Text: `{"id": "` + token + `"}`}
+	return r
+}
+
+func TestGUIDTransformIsStableForTheSession(t *testing.T) {
+	session := NewSession()
+	transform := &GUIDTransform{}
+	transform.UseSession(session)
+
+	first := requestWithToken("GUID1")
+	first.URL += "/GUID4"
+	transform.T(first)
+	second := requestWithToken("GUID1")
+	transform.T(second)
+
+	guid1, _ := session.Get("GUID1")
+	guid4, _ := session.Get("GUID4")
+	if guid1 == "" || guid4 == "" || guid1 == guid4 {
+		t.Fatalf("Expected a distinct GUID for each token, got: %q and %q", guid1, guid4)
+	}
+	if first.URL != "https://example.com/things/"+guid1+"/"+guid4 {
+		t.Errorf("Expected the URL's tokens to be replaced, got: %s", first.URL)
+	}
+	if second.URL != "https://example.com/things/"+guid1 || headerValue(second, "X-Thing") != guid1 {
+		t.Errorf("Expected the same GUID in later requests, got: %s", second.URL)
+	}
+	if !strings.Contains(second.PostData.Text, guid1) || second.BodySize != len(second.PostData.Text) {
+		t.Errorf("Expected the body's token to be replaced, got: %s (%d bytes)", second.PostData.Text, second.BodySize)
+	}
+
+	// Another session gets its own GUIDs
+	other := &GUIDTransform{}
+	other.UseSession(NewSession())
+	third := requestWithToken("GUID1")
+	other.T(third)
+	if third.URL == second.URL {
+		t.Errorf("Expected another session to have its own GUID, got: %s", third.URL)
+	}
+}
+
+func TestTimestampTransform(t *testing.T) {
+	before := time.Now().Unix()
+	r := requestWithToken("UNIXTIME")
+	(&TimestampTransform{Token: "UNIXTIME"}).T(r)
+	unix, err := strconv.ParseInt(headerValue(r, "X-Thing"), 10, 64)
+	if err != nil || unix < before || unix > time.Now().Unix() {
+		t.Errorf("Expected the current unix time, got: %s", headerValue(r, "X-Thing"))
+	}
+
+	r = requestWithToken("NOW")
+	(&TimestampTransform{Token: "NOW", Format: "iso8601"}).T(r)
+	if _, err := time.Parse(time.RFC3339, headerValue(r, "X-Thing")); err != nil {
+		t.Errorf("Expected an ISO 8601 time, got: %s", headerValue(r, "X-Thing"))
+	}
+}
+
+func TestRandomIntTransform(t *testing.T) {
+	transform := &RandomIntTransform{Token: "RANDOM", Min: 5, Max: 7}
+	for i := 0; i < 20; i++ {
+		r := requestWithToken("RANDOM")
+		transform.T(r)
+		value, err := strconv.Atoi(headerValue(r, "X-Thing"))
+		if err != nil || value < 5 || value > 7 {
+			t.Fatalf("Expected a number from 5 to 7, got: %s", headerValue(r, "X-Thing"))
+		}
+		if r.URL != "https://example.com/things/"+strconv.Itoa(value) {
+			t.Errorf("Expected the same number throughout the request, got: %s", r.URL)
+		}
+	}
+}
+
+func TestRandomStringTransform(t *testing.T) {
+	transform := &RandomStringTransform{Token: "RANDOM", Length: 8, Characters: "ab"}
+	r := requestWithToken("RANDOM")
+	transform.T(r)
+	if !regexp.MustCompile(`^[ab]{8}$`).MatchString(headerValue(r, "X-Thing")) {
+		t.Errorf("Expected 8 a's and b's, got: %s", headerValue(r, "X-Thing"))
+	}
+
+	r = requestWithToken("RANDOM")
+	(&RandomStringTransform{Token: "RANDOM"}).T(r)
+	if len(headerValue(r, "X-Thing")) != defaultRandomLength {
+		t.Errorf("Expected %d characters by default, got: %s", defaultRandomLength, headerValue(r, "X-Thing"))
+	}
+}
+
+func TestCounterTransform(t *testing.T) {
+	transform := &CounterTransform{Token: "COUNTER", Start: 10, Step: 5}
+	values := []string{}
+	for i := 0; i < 3; i++ {
+		r := requestWithToken("COUNTER")
+		transform.T(r)
+		values = append(values, headerValue(r, "X-Thing"))
+	}
+	// Requests without the token don't use up a number
+	transform.T(util.MakeRequest())
+	r := requestWithToken("COUNTER")
+	transform.T(r)
+	values = append(values, headerValue(r, "X-Thing"))
+
+	if strings.Join(values, ",") != "10,15,20,25" {
+		t.Errorf("Expected the counter to go up by 5 per request, got: %v", values)
+	}
+}
@@ -12,6 +12,18 @@ type HeaderInjectionTransform struct {
 
 var _ RequestTransform = HeaderInjectionTransform{}
 
+func init() {
+	Register(Type{
+		Name:        "HeaderInjectionTransform",
+		Description: "Adds a header to every request",
+		Fields: []Field{
+			{Name: "key", Type: "string", Required: true, Description: "the header's name"},
+			{Name: "value", Type: "string", Description: "the header's value"},
+		},
+		New: func() RequestTransform { return &HeaderInjectionTransform{} },
+	})
+}
+
 // T is because I don't know how to inherit from a func
 func (t HeaderInjectionTransform) T(r *model.Request) ResponseTransform {
 	r.Headers = append(r.Headers, model.SingleItemMap{
@@ -45,6 +45,21 @@ type HeaderToHeaderTransform struct {
 	After       string `json:"after"`        // What to put into the header value after the match
 }
 
+func init() {
+	Register(Type{
+		Name:        "HeaderToHeaderTransform",
+		Description: "Finds a value in a response header and sends it in a header of every request after that",
+		Fields: []Field{
+			{Name: "response_key", Type: "string", Description: "which response header to look in, all of them when blank"},
+			{Name: "pattern", Type: "string", Required: true, Description: "a regular expression, the first group (or the whole match) is the value"},
+			{Name: "request_key", Type: "string", Required: true, Description: "which header to put the value into"},
+			{Name: "before", Type: "string", Description: "what to put into the header before the value"},
+			{Name: "after", Type: "string", Description: "what to put into the header after the value"},
+		},
+		New: func() RequestTransform { return &HeaderToHeaderTransform{} },
+	})
+}
+
 // T is because I don't know how to inherit from a func
 func (t HeaderToHeaderTransform) T(r *model.Request) ResponseTransform {
 	// Find the string as a regular expression in the body somewhere and prepare
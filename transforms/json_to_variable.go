@@ -0,0 +1,107 @@
+package transforms
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+
+	"github.com/JackDanger/traffic/model"
+)
+
+// JSONToVariableTransform reads a value out of a JSON response and stores it
+// in a session variable for later requests to use. Unlike the regular
+// expressions of BodyToHeaderTransform it doesn't care how the JSON is
+// formatted or what order the fields are in.
+//
+// Only responses to requests whose URL matches URLPattern are read and each
+// of them has to have a value at the Path. When one doesn't the request is
+// reported as failed rather than carrying on with a stale or missing value.
+//
+// Example:
+//
+//   Given a response to POST https://api.example.com/login of:
+//     {"data": {"sessions": [{"token": "ABC123"}]}}
+//
+//   And a transform defined as:
+//     JSONToVariableTransform{
+//       URLPattern: "/login$",
+//       Path:       "$.data.sessions[0].token",
+//       Variable:   "token",
+//     }
+//
+//   The session's "token" variable will be "ABC123".
+type JSONToVariableTransform struct {
+	URLPattern string `json:"url_pattern"` // a regular expression, blank matches every request
+	Path       string `json:"path"`        // a JSONPath, see JSONPath
+	Variable   string `json:"variable"`    // the name to store the value under
+	session    *Session
+}
+
+var _ SessionTransform = &JSONToVariableTransform{}
+
+func init() {
+	Register(Type{
+		Name:        "JSONToVariableTransform",
+		Description: "Stores a value found by a JSONPath in a JSON response in a session variable",
+		Fields: []Field{
+			{Name: "url_pattern", Type: "string", Required: true, Description: "a regular expression, only responses to requests with matching URLs are read"},
+			{Name: "path", Type: "string", Required: true, Description: "a JSONPath like $.data.users[0].token or $..token"},
+			{Name: "variable", Type: "string", Required: true, Description: "the name of the variable to store the value in"},
+		},
+		New: func() RequestTransform { return &JSONToVariableTransform{} },
+	})
+}
+
+// UseSession is where the value will be stored
+func (t *JSONToVariableTransform) UseSession(session *Session) {
+	t.session = session
+}
+
+// T is because I don't know how to inherit from a func
+func (t *JSONToVariableTransform) T(r *model.Request) ResponseTransform {
+	if t.session == nil {
+		t.session = NewSession()
+	}
+	matched, err := regexp.MatchString(t.URLPattern, r.URL)
+	if err != nil {
+		t.session.Fail(fmt.Errorf("JSONToVariableTransform: bad url_pattern: %s", err))
+		return passthrough{requestTransform: t}
+	}
+	if !matched {
+		return passthrough{requestTransform: t}
+	}
+
+	// Keep reading every matching response in case the value changes, e.g.
+	// when a token is refreshed
+	return responseProcessor{
+		Tmethod: func(response *model.Response) RequestTransform {
+			value, err := t.extract(response)
+			if err != nil {
+				t.session.Fail(fmt.Errorf("JSONToVariableTransform %s from %s: %s", t.Path, r.URL, err))
+			} else {
+				t.session.Set(t.Variable, value)
+			}
+			return t
+		},
+	}
+}
+
+// extract finds the first value at the Path
+func (t *JSONToVariableTransform) extract(response *model.Response) (string, error) {
+	path, err := ParseJSONPath(t.Path)
+	if err != nil {
+		return "", err
+	}
+	if response.ContentBody == nil || *response.ContentBody == "" {
+		return "", errors.New("the response has no body")
+	}
+	document, err := DecodeJSON(*response.ContentBody)
+	if err != nil {
+		return "", fmt.Errorf("the response isn't JSON: %s", err)
+	}
+	found := path.Find(document)
+	if len(found) == 0 {
+		return "", errors.New("no such path in the response")
+	}
+	return JSONValueString(found[0]), nil
+}
@@ -0,0 +1,319 @@
+package transforms
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// JSONPath is a parsed JSONPath expression. Enough of the syntax is supported
+// to reach anything in an API response:
+//
+//   $.data.token          a field of a field
+//   $.users[0].id         an element of an array ([-1] is the last one)
+//   $['odd key'].id       a field whose name isn't a plain word
+//   $.users[*].id         every element of an array (or field of an object)
+//   $..token              a field at any depth, including inside arrays
+//
+// The leading "$" is optional.
+type JSONPath struct {
+	Expression string
+	steps      []pathStep
+}
+
+type pathStep struct {
+	key       string
+	index     int
+	isIndex   bool
+	wildcard  bool
+	recursive bool // search every level below for the key (or index)
+}
+
+// ParseJSONPath understands a JSONPath expression or says what's wrong with it
+func ParseJSONPath(expression string) (JSONPath, error) {
+	path := JSONPath{Expression: expression}
+	rest := strings.TrimSpace(expression)
+	rest = strings.TrimPrefix(rest, "$")
+	fail := func(message string) (JSONPath, error) {
+		return JSONPath{}, fmt.Errorf("bad JSONPath %q: %s", expression, message)
+	}
+
+	for rest != "" {
+		step := pathStep{}
+		switch {
+		case strings.HasPrefix(rest, ".."):
+			step.recursive = true
+			rest = rest[2:]
+			if strings.HasPrefix(rest, "[") {
+				break
+			}
+			fallthrough
+		case strings.HasPrefix(rest, "."):
+			rest = strings.TrimPrefix(rest, ".")
+			end := strings.IndexAny(rest, ".[")
+			if end < 0 {
+				end = len(rest)
+			}
+			if end == 0 {
+				return fail("expected a field name after '.'")
+			}
+			step.key, rest = rest[:end], rest[end:]
+			step.wildcard = step.key == "*"
+			path.steps = append(path.steps, step)
+			continue
+		case strings.HasPrefix(rest, "["):
+		default:
+			if len(path.steps) == 0 {
+				// e.g. "data.token" without the "$."
+				rest = "." + rest
+				continue
+			}
+			return fail(fmt.Sprintf("unexpected %q", rest))
+		}
+
+		// Brackets: ['key'], ["key"], [3], [-1] or [*]
+		end := strings.Index(rest, "]")
+		if end < 0 {
+			return fail("missing ']'")
+		}
+		inside := strings.TrimSpace(rest[1:end])
+		rest = rest[end+1:]
+		switch {
+		case inside == "*":
+			step.wildcard = true
+		case len(inside) >= 2 && (inside[0] == '\'' || inside[0] == '"') && inside[len(inside)-1] == inside[0]:
+			step.key = inside[1 : len(inside)-1]
+		default:
+			index, err := strconv.Atoi(inside)
+			if err != nil {
+				return fail(fmt.Sprintf("%q isn't an index, a quoted name or *", inside))
+			}
+			step.index, step.isIndex = index, true
+		}
+		path.steps = append(path.steps, step)
+	}
+	return path, nil
+}
+
+// Find is every value the path leads to in a decoded JSON document. Arrays
+// are in order and objects in order of their keys.
+func (p JSONPath) Find(document interface{}) []interface{} {
+	nodes := []interface{}{document}
+	for _, step := range p.steps {
+		next := []interface{}{}
+		for _, node := range nodes {
+			if step.recursive {
+				for _, descendant := range descendants(node) {
+					next = append(next, step.apply(descendant)...)
+				}
+			} else {
+				next = append(next, step.apply(node)...)
+			}
+		}
+		nodes = next
+	}
+	return nodes
+}
+
+// apply is what one step leads to from a single value
+func (s pathStep) apply(node interface{}) []interface{} {
+	switch n := node.(type) {
+	case map[string]interface{}:
+		if s.wildcard {
+			values := []interface{}{}
+			for _, key := range sortedKeys(n) {
+				values = append(values, n[key])
+			}
+			return values
+		}
+		if value, ok := n[s.key]; ok && !s.isIndex {
+			return []interface{}{value}
+		}
+	case []interface{}:
+		if s.wildcard {
+			return n
+		}
+		if s.isIndex {
+			index := s.index
+			if index < 0 {
+				index += len(n)
+			}
+			if index >= 0 && index < len(n) {
+				return []interface{}{n[index]}
+			}
+		}
+	}
+	return nil
+}
+
+// descendants is the value itself and everything inside of it
+func descendants(node interface{}) []interface{} {
+	all := []interface{}{node}
+	switch n := node.(type) {
+	case map[string]interface{}:
+		for _, key := range sortedKeys(n) {
+			all = append(all, descendants(n[key])...)
+		}
+	case []interface{}:
+		for _, value := range n {
+			all = append(all, descendants(value)...)
+		}
+	}
+	return all
+}
+
+// sortedKeys keeps results in a predictable order since JSON objects don't
+// have one once decoded
+func sortedKeys(object map[string]interface{}) []string {
+	keys := make([]string, 0, len(object))
+	for key := range object {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// DecodeJSON decodes a document keeping numbers exactly as they were written
+// so that large IDs survive being extracted
+func DecodeJSON(content string) (interface{}, error) {
+	decoder := json.NewDecoder(strings.NewReader(content))
+	decoder.UseNumber()
+	var document interface{}
+	if err := decoder.Decode(&document); err != nil {
+		return nil, err
+	}
+	return document, nil
+}
+
+// JSONValueString is how an extracted value is used in a request: strings
+// as they are, everything else as it's written in JSON
+func JSONValueString(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	}
+	encoded, _ := json.Marshal(value)
+	return string(encoded)
+}
+
+// Edit changes every value the path leads to in a decoded JSON document and
+// returns the changed document and how many values were edited. The edit is
+// given the value and whether it exists, which it only doesn't when the path
+// ends in a field the object doesn't have, and returns the new value and
+// whether to keep it at all.
+func (p JSONPath) Edit(document interface{}, edit func(value interface{}, exists bool) (interface{}, bool)) (interface{}, int) {
+	if len(p.steps) == 0 {
+		value, _ := edit(document, true)
+		return value, 1
+	}
+	edited, _, count := editPath(document, p.steps, edit)
+	return edited, count
+}
+
+func editPath(node interface{}, steps []pathStep, edit func(interface{}, bool) (interface{}, bool)) (interface{}, bool, int) {
+	if len(steps) == 0 {
+		value, keep := edit(node, true)
+		return value, keep, 1
+	}
+	step, rest := steps[0], steps[1:]
+	count := 0
+
+	if step.recursive {
+		// Match the step here and anywhere below here
+		here := step
+		here.recursive = false
+		var edited int
+		node, edited = editChildren(node, here, rest, edit, false)
+		count += edited
+		switch n := node.(type) {
+		case map[string]interface{}:
+			for _, key := range sortedKeys(n) {
+				value, _, edited := editPath(n[key], steps, edit)
+				n[key] = value
+				count += edited
+			}
+		case []interface{}:
+			for i := range n {
+				value, _, edited := editPath(n[i], steps, edit)
+				n[i] = value
+				count += edited
+			}
+		}
+		return node, true, count
+	}
+
+	node, count = editChildren(node, step, rest, edit, true)
+	return node, true, count
+}
+
+// editChildren edits whatever a single step leads to from the node. A missing
+// field is only added when create is set, which a search at any depth isn't.
+func editChildren(node interface{}, step pathStep, rest []pathStep, edit func(interface{}, bool) (interface{}, bool), create bool) (interface{}, int) {
+	count := 0
+	switch n := node.(type) {
+	case map[string]interface{}:
+		if step.isIndex {
+			return node, 0
+		}
+		keys := []string{step.key}
+		if step.wildcard {
+			keys = sortedKeys(n)
+		}
+		for _, key := range keys {
+			current, exists := n[key]
+			if !exists {
+				if len(rest) > 0 || step.wildcard || !create {
+					continue
+				}
+				// The last field can be added
+				if value, keep := edit(nil, false); keep {
+					n[key] = value
+					count++
+				}
+				continue
+			}
+			value, keep, edited := editPath(current, rest, edit)
+			if keep {
+				n[key] = value
+			} else {
+				delete(n, key)
+			}
+			count += edited
+		}
+		return n, count
+	case []interface{}:
+		indexes := []int{}
+		if step.wildcard {
+			for i := range n {
+				indexes = append(indexes, i)
+			}
+		} else if step.isIndex {
+			index := step.index
+			if index < 0 {
+				index += len(n)
+			}
+			if index >= 0 && index < len(n) {
+				indexes = append(indexes, index)
+			}
+		}
+		removed := map[int]bool{}
+		for _, i := range indexes {
+			value, keep, edited := editPath(n[i], rest, edit)
+			n[i] = value
+			removed[i] = !keep
+			count += edited
+		}
+		kept := n[:0]
+		for i, value := range n {
+			if !removed[i] {
+				kept = append(kept, value)
+			}
+		}
+		return kept, count
+	}
+	return node, 0
+}
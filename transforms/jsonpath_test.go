@@ -0,0 +1,103 @@
+package transforms
+
+import (
+	"testing"
+)
+
+func TestJSONPath(t *testing.T) {
+	document, err := DecodeJSON(`{
+		"data": {
+			"users": [
+				{"id": 9007199254740993, "name": "first", "sessions": [{"token": "abc"}]},
+				{"id": 2, "name": "second", "sessions": [{"token": "def"}, {"token": "ghi"}]}
+			],
+			"odd key": {"ok": true}
+		}
+	}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for expression, expected := range map[string][]string{
+		"$.data.users[0].name":                {"first"},
+		"data.users[1].name":                  {"second"},
+		"$.data.users[-1].sessions[-1].token": {"ghi"},
+		"$.data.users[*].name":                {"first", "second"},
+		"$['data']['odd key'].ok":             {"true"},
+		"$..token":                            {"abc", "def", "ghi"},
+		"$..sessions[1].token":                {"ghi"},
+		"$.data.users[0].id":                  {"9007199254740993"},
+		"$.data.users[0].sessions":            {`[{"token":"abc"}]`},
+		"$.data.missing":                      {},
+		"$.data.users[7]":                     {},
+	} {
+		path, err := ParseJSONPath(expression)
+		if err != nil {
+			t.Errorf("Expected %s to parse, got: %s", expression, err)
+			continue
+		}
+		found := []string{}
+		for _, value := range path.Find(document) {
+			found = append(found, JSONValueString(value))
+		}
+		if len(found) != len(expected) {
+			t.Errorf("Expected %s to find %v, got: %v", expression, expected, found)
+			continue
+		}
+		for i := range found {
+			if found[i] != expected[i] {
+				t.Errorf("Expected %s to find %v, got: %v", expression, expected, found)
+			}
+		}
+	}
+}
+
+func TestJSONPathErrors(t *testing.T) {
+	for _, expression := range []string{"$.data[0", "$.data[zero]", "$.data.", "$.data..."} {
+		if _, err := ParseJSONPath(expression); err == nil {
+			t.Errorf("Expected %q to be rejected", expression)
+		}
+	}
+}
+
+func TestJSONPathEdit(t *testing.T) {
+	document, _ := DecodeJSON(`{"data": {"users": [{"id": 1, "token": "a"}, {"id": 2, "token": "b"}], "token": "c"}}`)
+	set := func(value interface{}) func(interface{}, bool) (interface{}, bool) {
+		return func(interface{}, bool) (interface{}, bool) { return value, true }
+	}
+	remove := func(interface{}, bool) (interface{}, bool) { return nil, false }
+	edit := func(expression string, change func(interface{}, bool) (interface{}, bool)) int {
+		path, err := ParseJSONPath(expression)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var count int
+		document, count = path.Edit(document, change)
+		return count
+	}
+	encoded := func() string {
+		text, _ := encodeJSON(document)
+		return text
+	}
+
+	if count := edit("$..token", set("x")); count != 3 {
+		t.Errorf("Expected every token to be set, got: %d", count)
+	}
+	if count := edit("$.data.users[-1]", remove); count != 1 {
+		t.Errorf("Expected the last user to be deleted, got: %d", count)
+	}
+	if count := edit("$.data.users[0].name", set("Alice")); count != 1 {
+		t.Errorf("Expected a missing field to be added, got: %d", count)
+	}
+	if count := edit("$..missing", set("y")); count != 0 {
+		t.Errorf("Expected nothing to be added at any depth, got: %d", count)
+	}
+	if count := edit("$.nowhere.id", set("z")); count != 0 {
+		t.Errorf("Expected nothing to be added under a missing field, got: %d", count)
+	}
+
+	expected := `{"data":{"token":"x","users":[{"id":1,"name":"Alice","token":"x"}]}}`
+	if encoded() != expected {
+		t.Errorf("Expected %s, got: %s", expected, encoded())
+	}
+}
@@ -0,0 +1,159 @@
+package transforms
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+)
+
+// Type describes one kind of RequestTransform so that it can be stored,
+// listed in a config file, or offered in a form by name alone. Every
+// transform registers its Type when the package is loaded:
+//
+//   func init() {
+//     Register(Type{
+//       Name:        "HeaderInjectionTransform",
+//       Description: "Adds a header to every request",
+//       Fields:      []Field{{Name: "key", Type: "string", Required: true}},
+//       New:         func() RequestTransform { return &HeaderInjectionTransform{} },
+//     })
+//   }
+type Type struct {
+	Name        string  `json:"name"` // what persistence.Transform.Type and config files call it
+	Description string  `json:"description"`
+	Fields      []Field `json:"fields"`
+
+	// New returns an empty instance, as a pointer, for settings to be
+	// unmarshaled into
+	New func() RequestTransform `json:"-"`
+}
+
+// Field is one of the settings of a transform, named as it is in JSON
+type Field struct {
+	Name        string `json:"name"`
+	Type        string `json:"type"` // a JSON Schema type: string, integer, boolean, object or array
+	Description string `json:"description"`
+	Required    bool   `json:"required"`
+}
+
+// Schema is a JSON Schema for the transform's settings
+func (t Type) Schema() map[string]interface{} {
+	properties := map[string]interface{}{}
+	required := []string{}
+	for _, field := range t.Fields {
+		properties[field.Name] = map[string]interface{}{
+			"type":        field.Type,
+			"description": field.Description,
+		}
+		if field.Required {
+			required = append(required, field.Name)
+		}
+	}
+	return map[string]interface{}{
+		"title":       t.Name,
+		"description": t.Description,
+		"type":        "object",
+		"properties":  properties,
+		"required":    required,
+	}
+}
+
+// MarshalJSON includes the Schema alongside the description
+func (t Type) MarshalJSON() ([]byte, error) {
+	type plain Type
+	return json.Marshal(struct {
+		plain
+		Schema map[string]interface{} `json:"schema"`
+	}{plain(t), t.Schema()})
+}
+
+var registry = struct {
+	m     sync.RWMutex
+	types map[string]Type
+}{types: map[string]Type{}}
+
+// Register makes a kind of transform available by name. It panics if the
+// name is taken because that's a mistake in the code, not in what anyone
+// asked for.
+func Register(t Type) {
+	if t.Name == "" || t.New == nil {
+		panic("transforms: a registered Type needs a Name and a New")
+	}
+	registry.m.Lock()
+	defer registry.m.Unlock()
+	if _, taken := registry.types[t.Name]; taken {
+		panic(fmt.Sprintf("transforms: %s is already registered", t.Name))
+	}
+	registry.types[t.Name] = t
+}
+
+// Lookup finds a registered kind of transform by name
+func Lookup(name string) (Type, bool) {
+	registry.m.RLock()
+	defer registry.m.RUnlock()
+	t, ok := registry.types[name]
+	return t, ok
+}
+
+// Types lists every registered kind of transform by name
+func Types() []Type {
+	registry.m.RLock()
+	defer registry.m.RUnlock()
+	types := make([]Type, 0, len(registry.types))
+	for _, t := range registry.types {
+		types = append(types, t)
+	}
+	sort.Slice(types, func(i, j int) bool { return types[i].Name < types[j].Name })
+	return types
+}
+
+// Decode builds a transform of the named kind from its JSON settings. It's an
+// error for a required setting to be missing or for there to be settings the
+// transform doesn't have, which are most likely misspelled.
+func Decode(name string, settings []byte) (RequestTransform, error) {
+	t, ok := Lookup(name)
+	if !ok {
+		return nil, fmt.Errorf("unknown transform type: %s", name)
+	}
+	instance := t.New()
+	decoder := json.NewDecoder(bytes.NewReader(settings))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(instance); err != nil {
+		return nil, err
+	}
+
+	given := map[string]json.RawMessage{}
+	if err := json.Unmarshal(settings, &given); err != nil {
+		return nil, err
+	}
+	for _, field := range t.Fields {
+		if value, ok := given[field.Name]; field.Required && (!ok || string(value) == "null") {
+			return nil, fmt.Errorf("%s needs a %s", name, field.Name)
+		}
+	}
+	return instance, nil
+}
+
+// NameOf is the name the transform's kind is registered under, whether it's
+// given as a value or a pointer
+func NameOf(transform RequestTransform) (string, error) {
+	goType := indirect(reflect.TypeOf(transform))
+	registry.m.RLock()
+	defer registry.m.RUnlock()
+	for name, t := range registry.types {
+		if indirect(reflect.TypeOf(t.New())) == goType {
+			return name, nil
+		}
+	}
+	return "", fmt.Errorf("%T isn't a registered transform type", transform)
+}
+
+func indirect(t reflect.Type) reflect.Type {
+	if t != nil && t.Kind() == reflect.Ptr {
+		return t.Elem()
+	}
+	return t
+}
@@ -0,0 +1,83 @@
+package transforms
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestRegisteredTypes(t *testing.T) {
+	names := []string{}
+	for _, transformType := range Types() {
+		names = append(names, transformType.Name)
+	}
+	if !sort.StringsAreSorted(names) {
+		t.Errorf("Expected the types in order of name, got: %v", names)
+	}
+	for _, expected := range []string{"BodyToHeaderTransform", "ConstantTransform", "HeaderInjectionTransform", "HeaderToHeaderTransform", "TargetTransform"} {
+		if _, ok := Lookup(expected); !ok {
+			t.Errorf("Expected %s to be registered, got: %v", expected, names)
+		}
+	}
+}
+
+func TestDecode(t *testing.T) {
+	transform, err := Decode("HeaderInjectionTransform", []byte(`{"key": "X-Test", "value": "yes"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	injection, ok := transform.(*HeaderInjectionTransform)
+	if !ok || injection.Key != "X-Test" || injection.Value != "yes" {
+		t.Errorf("Expected the settings in a new instance, got: %#v", transform)
+	}
+
+	if _, err := Decode("NoSuchTransform", []byte(`{}`)); err == nil || !strings.Contains(err.Error(), "unknown transform type") {
+		t.Errorf("Expected an unknown type to be an error, got: %v", err)
+	}
+	if _, err := Decode("HeaderInjectionTransform", []byte(`{`)); err == nil {
+		t.Errorf("Expected bad settings to be an error")
+	}
+	if _, err := Decode("HeaderInjectionTransform", []byte(`{"key": "X-Test", "valeu": "yes"}`)); err == nil || !strings.Contains(err.Error(), "valeu") {
+		t.Errorf("Expected an unknown setting to be an error, got: %v", err)
+	}
+	if _, err := Decode("HeaderInjectionTransform", []byte(`{"value": "yes"}`)); err == nil || !strings.Contains(err.Error(), "needs a key") {
+		t.Errorf("Expected a missing required setting to be an error, got: %v", err)
+	}
+}
+
+func TestNameOf(t *testing.T) {
+	for _, transform := range []RequestTransform{HeaderInjectionTransform{}, &HeaderInjectionTransform{}} {
+		name, err := NameOf(transform)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if name != "HeaderInjectionTransform" {
+			t.Errorf("Expected %T to be named HeaderInjectionTransform, got: %s", transform, name)
+		}
+	}
+	if _, err := NameOf(passthrough{}.requestTransform); err == nil {
+		t.Errorf("Expected an unregistered transform to be an error")
+	}
+}
+
+func TestTypeJSON(t *testing.T) {
+	transformType, _ := Lookup("ConstantTransform")
+	content, err := json.Marshal(transformType)
+	if err != nil {
+		t.Fatal(err)
+	}
+	described := struct {
+		Name   string `json:"name"`
+		Schema struct {
+			Properties map[string]interface{} `json:"properties"`
+			Required   []string               `json:"required"`
+		} `json:"schema"`
+	}{}
+	if err := json.Unmarshal(content, &described); err != nil {
+		t.Fatal(err)
+	}
+	if described.Name != "ConstantTransform" || described.Schema.Properties["search"] == nil || len(described.Schema.Required) != 2 {
+		t.Errorf("Expected a JSON Schema of the settings, got: %s", content)
+	}
+}
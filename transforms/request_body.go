@@ -0,0 +1,193 @@
+package transforms
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/JackDanger/traffic/model"
+)
+
+// RequestBodyTransform rewrites the bodies of requests, which the other
+// transforms leave alone. A regular expression can be replaced anywhere in
+// the body and, when the body is JSON, fields can be set, deleted or have a
+// regular expression replaced in them by their JSONPath. The body's size and
+// Content-Length are fixed to match afterwards.
+//
+// Only requests whose URL matches URLPattern are changed. A path that isn't
+// in a body is skipped, except that setting a missing field adds it.
+//
+// Example:
+//
+//   Given a request to POST https://api.example.com/orders with a body of:
+//     {"order": {"id": 17, "coupon": "SPRING", "note": "for Alice"}}
+//
+//   And a transform defined as:
+//     RequestBodyTransform{
+//       URLPattern: "/orders$",
+//       Edits: []BodyEdit{
+//         {Op: "set", Path: "$.order.id", Value: json.RawMessage(`"{{order_id}}"`)},
+//         {Op: "delete", Path: "$.order.coupon"},
+//         {Op: "replace", Path: "$.order.note", Pattern: "Alice", Replace: "Bob"},
+//       },
+//     }
+//
+//   The body sent is:
+//     {"order":{"id":"{{order_id}}","note":"for Bob"}}
+//   and then the session's order_id variable is filled in.
+type RequestBodyTransform struct {
+	URLPattern string     `json:"url_pattern"` // a regular expression, blank matches every request
+	Pattern    string     `json:"pattern"`     // a regular expression to replace anywhere in the body
+	Replace    string     `json:"replace"`     // what to replace it with, $1 etc. are its groups
+	Edits      []BodyEdit `json:"edits"`       // changes to JSON bodies, in order
+	session    *Session
+}
+
+// BodyEdit is one change to a field of a JSON body
+type BodyEdit struct {
+	Op      string          `json:"op"`      // set, delete or replace
+	Path    string          `json:"path"`    // a JSONPath, see JSONPath
+	Value   json.RawMessage `json:"value"`   // the JSON to set the field to
+	Pattern string          `json:"pattern"` // a regular expression to replace in the field's value
+	Replace string          `json:"replace"` // what to replace it with
+}
+
+var _ SessionTransform = &RequestBodyTransform{}
+
+func init() {
+	Register(Type{
+		Name:        "RequestBodyTransform",
+		Description: "Replaces text in request bodies or sets, deletes and changes the fields of JSON bodies",
+		Fields: []Field{
+			{Name: "url_pattern", Type: "string", Description: "a regular expression, only requests with matching URLs are changed"},
+			{Name: "pattern", Type: "string", Description: "a regular expression to replace anywhere in the body"},
+			{Name: "replace", Type: "string", Description: "what to replace the pattern with, $1 etc. are its groups"},
+			{Name: "edits", Type: "array", Description: `changes to JSON bodies, each an object of "op" (set, delete or replace), "path" (a JSONPath), and "value" to set or "pattern" and "replace"`},
+		},
+		New: func() RequestTransform { return &RequestBodyTransform{} },
+	})
+}
+
+// UseSession is where mistakes are reported
+func (t *RequestBodyTransform) UseSession(session *Session) {
+	t.session = session
+}
+
+// T is because I don't know how to inherit from a func
+func (t *RequestBodyTransform) T(r *model.Request) ResponseTransform {
+	if t.session == nil {
+		t.session = NewSession()
+	}
+	if r.PostData == nil || r.PostData.Text == "" {
+		return passthrough{requestTransform: t}
+	}
+	matched, err := regexp.MatchString(t.URLPattern, r.URL)
+	if err != nil {
+		t.session.Fail(fmt.Errorf("RequestBodyTransform: bad url_pattern: %s", err))
+		return passthrough{requestTransform: t}
+	}
+	if !matched {
+		return passthrough{requestTransform: t}
+	}
+
+	text, err := t.rewrite(r.PostData.Text, isJSON(r.PostData.MimeType))
+	if err != nil {
+		t.session.Fail(fmt.Errorf("RequestBodyTransform %s: %s", r.URL, err))
+		return passthrough{requestTransform: t}
+	}
+	if text != r.PostData.Text {
+		r.PostData.Text = text
+		fixBodySize(r)
+	}
+	return passthrough{requestTransform: t}
+}
+
+// rewrite makes every change to the body's text
+func (t *RequestBodyTransform) rewrite(text string, jsonBody bool) (string, error) {
+	if t.Pattern != "" {
+		pattern, err := regexp.Compile(t.Pattern)
+		if err != nil {
+			return "", fmt.Errorf("bad pattern: %s", err)
+		}
+		text = pattern.ReplaceAllString(text, t.Replace)
+	}
+	if len(t.Edits) == 0 || !jsonBody {
+		return text, nil
+	}
+
+	document, err := DecodeJSON(text)
+	if err != nil {
+		return "", fmt.Errorf("the body isn't JSON: %s", err)
+	}
+	for _, edit := range t.Edits {
+		if document, err = edit.apply(document); err != nil {
+			return "", err
+		}
+	}
+	return encodeJSON(document)
+}
+
+// apply makes the edit to a decoded document
+func (e BodyEdit) apply(document interface{}) (interface{}, error) {
+	path, err := ParseJSONPath(e.Path)
+	if err != nil {
+		return nil, err
+	}
+	switch e.Op {
+	case "set":
+		value, err := DecodeJSON(string(e.Value))
+		if err != nil {
+			return nil, fmt.Errorf("bad value to set %s to: %s", e.Path, err)
+		}
+		document, _ = path.Edit(document, func(interface{}, bool) (interface{}, bool) {
+			return value, true
+		})
+	case "delete":
+		document, _ = path.Edit(document, func(current interface{}, exists bool) (interface{}, bool) {
+			return nil, false
+		})
+	case "replace":
+		pattern, err := regexp.Compile(e.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("bad pattern for %s: %s", e.Path, err)
+		}
+		document, _ = path.Edit(document, func(current interface{}, exists bool) (interface{}, bool) {
+			if !exists {
+				return nil, false
+			}
+			replaced := pattern.ReplaceAllString(JSONValueString(current), e.Replace)
+			if _, isString := current.(string); isString {
+				return replaced, true
+			}
+			// Numbers and the like stay what they are if they still can be
+			if value, err := DecodeJSON(replaced); err == nil {
+				return value, true
+			}
+			return replaced, true
+		})
+	default:
+		return nil, fmt.Errorf("unknown op %q for %s, expected set, delete or replace", e.Op, e.Path)
+	}
+	return document, nil
+}
+
+// isJSON says whether a mime type is JSON, e.g. application/json or
+// application/vnd.api+json; charset=utf-8
+func isJSON(mimeType string) bool {
+	mimeType = strings.ToLower(strings.TrimSpace(strings.SplitN(mimeType, ";", 2)[0]))
+	return mimeType == "application/json" || mimeType == "text/json" || strings.HasSuffix(mimeType, "+json")
+}
+
+// encodeJSON writes a document without escaping HTML characters, which
+// nobody who sent the original body did either
+func encodeJSON(document interface{}) (string, error) {
+	buffer := &bytes.Buffer{}
+	encoder := json.NewEncoder(buffer)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(document); err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(buffer.String(), "\n"), nil
+}
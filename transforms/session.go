@@ -0,0 +1,78 @@
+package transforms
+
+import "sync"
+
+// Session is what one replay of an archive has learned so far, shared by all
+// of its transforms. Transforms that extract values from responses store them
+// here as named variables for others to use in later requests.
+//
+// Transforms that want their session implement SessionTransform and are
+// handed it by the runner before the first request.
+type Session struct {
+	m         sync.Mutex
+	variables map[string]string
+	errors    []error
+}
+
+// SessionTransform is a RequestTransform that reads or writes its session
+type SessionTransform interface {
+	RequestTransform
+	UseSession(*Session)
+}
+
+// NewSession starts a session that doesn't know anything yet
+func NewSession() *Session {
+	return &Session{variables: map[string]string{}}
+}
+
+// Get finds the value of a variable
+func (s *Session) Get(name string) (string, bool) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	value, ok := s.variables[name]
+	return value, ok
+}
+
+// Set stores the value of a variable, replacing any earlier one
+func (s *Session) Set(name, value string) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	s.variables[name] = value
+}
+
+// Variables is a copy of every variable that's been set
+func (s *Session) Variables() map[string]string {
+	s.m.Lock()
+	defer s.m.Unlock()
+	variables := make(map[string]string, len(s.variables))
+	for name, value := range s.variables {
+		variables[name] = value
+	}
+	return variables
+}
+
+// Fail records that a transform couldn't do what it was asked to. The runner
+// reports it as the error of the request being made at the time.
+func (s *Session) Fail(err error) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	s.errors = append(s.errors, err)
+}
+
+// Errors returns, and forgets, every failure since it was last called
+func (s *Session) Errors() []error {
+	s.m.Lock()
+	defer s.m.Unlock()
+	errors := s.errors
+	s.errors = nil
+	return errors
+}
+
+// UseSession hands the session to every transform that wants it
+func UseSession(session *Session, requestTransforms []RequestTransform) {
+	for _, transform := range requestTransforms {
+		if t, ok := transform.(SessionTransform); ok {
+			t.UseSession(session)
+		}
+	}
+}
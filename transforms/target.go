@@ -0,0 +1,157 @@
+package transforms
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/JackDanger/traffic/model"
+)
+
+// TargetTransform points requests recorded against one origin (scheme, host
+// and port) at another one, e.g. to replay a production HAR against staging.
+// Only the origin changes, paths and query strings are left alone. The Host,
+// Origin and Referer headers are rewritten to match.
+//
+// Example:
+//
+//   Given a transform defined as:
+//     TargetTransform{
+//       Targets: map[string]string{
+//         "https://www.example.com": "http://localhost:8000",
+//       },
+//     }
+//
+//   A request recorded as:
+//     GET https://www.example.com/users/1
+//     Host: www.example.com
+//
+//   Will be made as:
+//     GET http://localhost:8000/users/1
+//     Host: localhost:8000
+//
+// The special origin "*" matches any origin that isn't otherwise listed.
+type TargetTransform struct {
+	Targets map[string]string `json:"targets"` // recorded origin => origin to use instead
+}
+
+var _ RequestTransform = &TargetTransform{}
+
+func init() {
+	Register(Type{
+		Name:        "TargetTransform",
+		Description: "Sends requests recorded against one origin to another one instead",
+		Fields: []Field{
+			{Name: "targets", Type: "object", Required: true, Description: `recorded origin => origin to use instead, "*" matches any other origin`},
+		},
+		New: func() RequestTransform { return &TargetTransform{} },
+	})
+}
+
+// NewTargetTransform parses a comma-separated list of
+// "recorded-origin=new-origin" pairs. A bare origin with no "=" replaces
+// every recorded origin.
+func NewTargetTransform(spec string) (*TargetTransform, error) {
+	targets := map[string]string{}
+	for _, pair := range strings.Split(spec, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		from, to := "*", pair
+		if i := strings.Index(pair, "="); i >= 0 {
+			from, to = pair[:i], pair[i+1:]
+		}
+		if from != "*" {
+			if _, err := origin(from); err != nil {
+				return nil, err
+			}
+		}
+		if _, err := origin(to); err != nil {
+			return nil, err
+		}
+		targets[from] = to
+	}
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("no targets found in %q", spec)
+	}
+	return &TargetTransform{Targets: targets}, nil
+}
+
+// T is because I don't know how to inherit from a func
+func (t *TargetTransform) T(r *model.Request) ResponseTransform {
+	rewritten, retargeted := t.rewrite(r.URL)
+	if retargeted {
+		r.URL = rewritten
+	}
+
+	for _, header := range r.Headers {
+		switch strings.ToLower(*header.Key) {
+		case "host":
+			if u, err := url.Parse(r.URL); retargeted && err == nil {
+				*header.Value = u.Host
+			}
+		case "origin", "referer":
+			if rewritten, ok := t.rewrite(*header.Value); ok {
+				*header.Value = rewritten
+			}
+		}
+	}
+
+	// Don't do anything with the response and reuse this same transformation on
+	// the next request.
+	return passthrough{requestTransform: t}
+}
+
+// rewrite swaps the origin at the start of a URL for its target, if it has
+// one. The rest of the URL is left byte-for-byte as it was.
+func (t *TargetTransform) rewrite(rawURL string) (string, bool) {
+	recorded, err := origin(rawURL)
+	if err != nil {
+		return rawURL, false
+	}
+	for from, to := range t.Targets {
+		if from == "*" {
+			continue
+		}
+		if canonical, err := origin(from); err == nil && canonical == recorded {
+			return strings.TrimRight(to, "/") + rawURL[originLength(rawURL):], true
+		}
+	}
+	if to, ok := t.Targets["*"]; ok {
+		return strings.TrimRight(to, "/") + rawURL[originLength(rawURL):], true
+	}
+	return rawURL, false
+}
+
+// origin normalizes the scheme://host:port part of a URL so that, e.g.,
+// "https://Example.com:443" and "https://example.com/path" are the same.
+func origin(rawURL string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return "", fmt.Errorf("%q is not an origin like https://example.com", rawURL)
+	}
+	scheme := strings.ToLower(u.Scheme)
+	host := strings.ToLower(u.Hostname())
+	port := u.Port()
+	if (scheme == "http" && port == "80") || (scheme == "https" && port == "443") {
+		port = ""
+	}
+	if port != "" {
+		host = host + ":" + port
+	}
+	return scheme + "://" + host, nil
+}
+
+// originLength is how many bytes of the URL make up its scheme://host:port
+func originLength(rawURL string) int {
+	start := strings.Index(rawURL, "://") + len("://")
+	end := strings.IndexAny(rawURL[start:], "/?#")
+	if end < 0 {
+		return len(rawURL)
+	}
+	return start + end
+}
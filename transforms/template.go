@@ -0,0 +1,121 @@
+package transforms
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/JackDanger/traffic/model"
+)
+
+// placeholder matches {{name}} and, because recorded URLs are escaped,
+// %7B%7Bname%7D%7D
+var placeholder = regexp.MustCompile(`(?i)(?:\{\{|%7B%7B)\s*([A-Za-z_][\w.-]*)\s*(?:\}\}|%7D%7D)`)
+
+// Render fills every {{name}} placeholder in the text with the session's
+// variable of that name. Values are used as they are, without escaping.
+// Placeholders for variables that haven't been set are left alone and their
+// names returned.
+func (s *Session) Render(text string) (string, []string) {
+	if !strings.Contains(text, "{{") && !strings.Contains(strings.ToUpper(text), "%7B%7B") {
+		return text, nil
+	}
+	var missing []string
+	rendered := placeholder.ReplaceAllStringFunc(text, func(found string) string {
+		name := placeholder.FindStringSubmatch(found)[1]
+		if value, ok := s.Get(name); ok {
+			return value
+		}
+		missing = append(missing, name)
+		return found
+	})
+	return rendered, missing
+}
+
+// RenderRequest fills in the placeholders throughout a request: its URL,
+// query string, headers, cookies and body. A placeholder for a variable that
+// hasn't been set fails the request since sending it as-is would only hide
+// the mistake.
+func (s *Session) RenderRequest(r *model.Request) {
+	missing := map[string]bool{}
+	rewriteRequest(r, func(text string) string {
+		rendered, unset := s.Render(text)
+		for _, name := range unset {
+			missing[name] = true
+		}
+		return rendered
+	})
+
+	if len(missing) > 0 {
+		names := []string{}
+		for name := range missing {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		s.Fail(fmt.Errorf("no value for {{%s}} in %s", strings.Join(names, "}}, {{"), r.URL))
+	}
+}
+
+// eachString calls fn with every string in the request that can be changed:
+// the URL, the names and values of headers, query parameters, cookies and
+// form params, and the body's text.
+func eachString(r *model.Request, fn func(*string)) {
+	fn(&r.URL)
+	eachPair := func(pair *model.SingleItemMap) {
+		if pair.Key != nil {
+			fn(pair.Key)
+		}
+		if pair.Value != nil {
+			fn(pair.Value)
+		}
+	}
+	for i := range r.Headers {
+		eachPair(&r.Headers[i])
+	}
+	for i := range r.QueryString {
+		eachPair(&r.QueryString[i])
+	}
+	for i := range r.Cookies {
+		eachPair(&r.Cookies[i].SingleItemMap)
+	}
+	if r.PostData != nil {
+		fn(&r.PostData.Text)
+		for i := range r.PostData.Params {
+			eachPair(&r.PostData.Params[i])
+		}
+	}
+}
+
+// rewriteRequest replaces every string in the request with what rewrite
+// makes of it and keeps the body's size right if it changed
+func rewriteRequest(r *model.Request, rewrite func(string) string) {
+	originalBody := requestText(r)
+	eachString(r, func(text *string) {
+		*text = rewrite(*text)
+	})
+	if requestText(r) != originalBody {
+		fixBodySize(r)
+	}
+}
+
+func requestText(r *model.Request) string {
+	if r.PostData == nil {
+		return ""
+	}
+	return r.PostData.Text
+}
+
+// fixBodySize makes the recorded size of the body, and its Content-Length
+// header if it has one, match the body's text after it's been changed
+func fixBodySize(r *model.Request) {
+	size := len(requestText(r))
+	r.BodySize = size
+	for i, header := range r.Headers {
+		if header.Key != nil && strings.EqualFold(*header.Key, "Content-Length") {
+			length := strconv.Itoa(size)
+			r.Headers[i].Value = &length
+		}
+	}
+}
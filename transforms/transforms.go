@@ -48,6 +48,15 @@ type ResponseTransform interface {
 	T(*model.Response) RequestTransform
 }
 
+// RecordedResponseTransform is a ResponseTransform that also wants to see the
+// response that was recorded in the HAR, e.g. to find out which recorded
+// value a live one replaces. The runner hands it over, when there is one,
+// before calling T with the live response.
+type RecordedResponseTransform interface {
+	ResponseTransform
+	Recorded(*model.Response)
+}
+
 // Wraps a RequestTransform in a ResponseTransform that simply returns it.s
 type passthrough struct {
 	requestTransform RequestTransform
@@ -1,7 +1,9 @@
 package transforms
 
 import (
+	"encoding/json"
 	"reflect"
+	"strconv"
 	"strings"
 	"testing"
 
@@ -345,3 +347,300 @@ func TestHeaderPatternToHeaderTransform(t *testing.T) {
 	}
 
 }
+
+func TestTargetTransform(t *testing.T) {
+	transform, err := NewTargetTransform("https://api.github.com=http://localhost:8000, http://example.com:80=https://staging.example.com:8443")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	request := util.MakeRequest()
+	request.URL = "https://API.github.com:443/users/JackDanger/repos?page=2"
+	request.Headers = append(request.Headers,
+		model.SingleItemMap{Key: util.StringPtr("Host"), Value: util.StringPtr("api.github.com")},
+		model.SingleItemMap{Key: util.StringPtr("Origin"), Value: util.StringPtr("http://example.com")},
+		model.SingleItemMap{Key: util.StringPtr("Referer"), Value: util.StringPtr("http://example.com/profile?tab=repos")},
+	)
+
+	replacementTransform := transform.T(request).T(&model.Response{})
+	if replacementTransform != transform {
+		t.Error("the ResponseTransform returned something other than the original RequestTransform, which is unexpected")
+	}
+
+	if request.URL != "http://localhost:8000/users/JackDanger/repos?page=2" {
+		t.Errorf("url was not retargeted: %s", request.URL)
+	}
+	for key, value := range map[string]string{
+		"Host":    "localhost:8000",
+		"Origin":  "https://staging.example.com:8443",
+		"Referer": "https://staging.example.com:8443/profile?tab=repos",
+	} {
+		if !util.Any(request.Headers, func(k, v *string) bool {
+			return *k == key && *v == value
+		}) {
+			t.Errorf("expected %s header to be %s: %v", key, value, request.Headers)
+		}
+	}
+}
+
+func TestTargetTransformLeavesOtherOriginsAlone(t *testing.T) {
+	transform, err := NewTargetTransform("https://www.example.com=http://localhost:8000")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	request := util.MakeRequest()
+	original := request.URL
+	transform.T(request)
+	if request.URL != original {
+		t.Errorf("url should not have been retargeted: %s", request.URL)
+	}
+}
+
+func TestTargetTransformWithoutAnOriginMatchesEverything(t *testing.T) {
+	transform, err := NewTargetTransform("http://localhost:8000/")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	request := util.MakeRequest()
+	transform.T(request)
+	if request.URL != "http://localhost:8000/users/JackDanger/repos" {
+		t.Errorf("url was not retargeted: %s", request.URL)
+	}
+}
+
+func TestNewTargetTransformRejectsNonOrigins(t *testing.T) {
+	for _, spec := range []string{"", "localhost:8000", "https://example.com=/just/a/path"} {
+		if _, err := NewTargetTransform(spec); err == nil {
+			t.Errorf("expected %q to be rejected", spec)
+		}
+	}
+}
+
+func TestJSONToVariableTransform(t *testing.T) {
+	session := NewSession()
+	transform := &JSONToVariableTransform{
+		URLPattern: "/login$",
+		Path:       "$.data.sessions[*].token",
+		Variable:   "token",
+	}
+	transform.UseSession(session)
+
+	// Responses to other requests aren't read at all
+	request := util.MakeRequest()
+	request.URL = "https://example.com/users"
+	response := util.MakeResponse()
+	response.ContentBody = util.StringPtr(`not even JSON`)
+	transform.T(request).T(response)
+	if errs := session.Errors(); len(errs) != 0 {
+		t.Errorf("Expected other responses to be ignored, got: %v", errs)
+	}
+
+	request.URL = "https://example.com/login"
+	response.ContentBody = util.StringPtr(`{"data": {"sessions": [{"token": "ABC123"}, {"token": "DEF456"}]}}`)
+	replacement := transform.T(request).T(response)
+	if replacement != transform {
+		t.Errorf("Expected the transform to keep itself, got: %#v", replacement)
+	}
+	if token, _ := session.Get("token"); token != "ABC123" {
+		t.Errorf("Expected the first token to be stored, got: %q", token)
+	}
+
+	// A response without the value is a failure
+	response.ContentBody = util.StringPtr(`{"data": {"error": "bad password"}}`)
+	transform.T(request).T(response)
+	errs := session.Errors()
+	if len(errs) != 1 || !strings.Contains(errs[0].Error(), "$.data.sessions[*].token") || !strings.Contains(errs[0].Error(), "no such path") {
+		t.Errorf("Expected a clear error about the missing path, got: %v", errs)
+	}
+	if token, _ := session.Get("token"); token != "ABC123" {
+		t.Errorf("Expected the earlier token to be kept, got: %q", token)
+	}
+}
+
+func TestSessionRenderRequest(t *testing.T) {
+	session := NewSession()
+	session.Set("token", "ABC123")
+	session.Set("user_id", "7")
+
+	r := util.MakeRequest()
+	r.URL = "https://example.com/users/{{user_id}}?q=%7B%7Btoken%7D%7D"
+	r.Headers = append(r.Headers, model.SingleItemMap{Key: util.StringPtr("Authorization"), Value: util.StringPtr("Bearer {{ token }}")})
+	r.Headers = append(r.Headers, model.SingleItemMap{Key: util.StringPtr("Content-Length"), Value: util.StringPtr("21")})
+	r.PostData = &model.PostData{MimeType: "application/json", Text: `{"user": "{{user_id}}"}`}
+	r.BodySize = 21
+
+	session.RenderRequest(r)
+
+	if r.URL != "https://example.com/users/7?q=ABC123" {
+		t.Errorf("Expected the URL to be filled in, got: %s", r.URL)
+	}
+	if value := headerValue(r, "Authorization"); value != "Bearer ABC123" {
+		t.Errorf("Expected the header to be filled in, got: %s", value)
+	}
+	if r.PostData.Text != `{"user": "7"}` {
+		t.Errorf("Expected the body to be filled in, got: %s", r.PostData.Text)
+	}
+	if r.BodySize != len(r.PostData.Text) || headerValue(r, "Content-Length") != "13" {
+		t.Errorf("Expected the body's size to be updated, got: %d and %s", r.BodySize, headerValue(r, "Content-Length"))
+	}
+	if errs := session.Errors(); len(errs) != 0 {
+		t.Errorf("Expected no errors, got: %v", errs)
+	}
+
+	// Unset variables are left alone and fail the request
+	r.URL = "https://example.com/orders/{{order_id}}"
+	session.RenderRequest(r)
+	if r.URL != "https://example.com/orders/{{order_id}}" {
+		t.Errorf("Expected the unset placeholder to be kept, got: %s", r.URL)
+	}
+	errs := session.Errors()
+	if len(errs) != 1 || !strings.Contains(errs[0].Error(), "{{order_id}}") {
+		t.Errorf("Expected an error naming the unset variable, got: %v", errs)
+	}
+}
+
+func headerValue(r *model.Request, key string) string {
+	for _, header := range r.Headers {
+		if header.Key != nil && *header.Key == key && header.Value != nil {
+			return *header.Value
+		}
+	}
+	return ""
+}
+
+func TestRequestBodyTransform(t *testing.T) {
+	session := NewSession()
+	transform := &RequestBodyTransform{}
+	settings := `{
+		"url_pattern": "/orders$",
+		"pattern": "SPRING(\\d+)",
+		"replace": "FALL$1",
+		"edits": [
+			{"op": "set", "path": "$.order.id", "value": "{{order_id}}"},
+			{"op": "delete", "path": "$.order.internal"},
+			{"op": "replace", "path": "$.order.quantity", "pattern": "^3$", "replace": "4"},
+			{"op": "set", "path": "$.order.gift", "value": true}
+		]
+	}`
+	if err := json.Unmarshal([]byte(settings), transform); err != nil {
+		t.Fatal(err)
+	}
+	transform.UseSession(session)
+
+	r := util.MakeRequest()
+	r.URL = "https://example.com/orders"
+	r.PostData = &model.PostData{
+		MimeType: "application/json; charset=utf-8",
+		Text:     `{"order": {"id": 17, "coupon": "SPRING20", "internal": "<x>", "quantity": 3}}`,
+	}
+	r.Headers = append(r.Headers, model.SingleItemMap{Key: util.StringPtr("Content-Length"), Value: util.StringPtr("81")})
+	transform.T(r)
+
+	expected := `{"order":{"coupon":"FALL20","gift":true,"id":"{{order_id}}","quantity":4}}`
+	if r.PostData.Text != expected {
+		t.Errorf("Expected the body to be %s, got: %s", expected, r.PostData.Text)
+	}
+	if r.BodySize != len(expected) || headerValue(r, "Content-Length") != strconv.Itoa(len(expected)) {
+		t.Errorf("Expected the body's size to be fixed, got: %d and %s", r.BodySize, headerValue(r, "Content-Length"))
+	}
+	if errs := session.Errors(); len(errs) != 0 {
+		t.Errorf("Expected no errors, got: %v", errs)
+	}
+
+	// Other bodies are only changed by the pattern
+	r.PostData = &model.PostData{MimeType: "application/x-www-form-urlencoded", Text: "coupon=SPRING20"}
+	transform.T(r)
+	if r.PostData.Text != "coupon=FALL20" {
+		t.Errorf("Expected the pattern to be replaced in a form body, got: %s", r.PostData.Text)
+	}
+
+	// And only for matching URLs
+	r.URL = "https://example.com/carts"
+	r.PostData = &model.PostData{MimeType: "application/json", Text: `{"coupon": "SPRING20"}`}
+	transform.T(r)
+	if r.PostData.Text != `{"coupon": "SPRING20"}` {
+		t.Errorf("Expected other URLs to be left alone, got: %s", r.PostData.Text)
+	}
+
+	// A JSON body that isn't is a failure
+	r.URL = "https://example.com/orders"
+	r.PostData = &model.PostData{MimeType: "application/json", Text: `{"order": `}
+	transform.T(r)
+	if errs := session.Errors(); len(errs) != 1 || !strings.Contains(errs[0].Error(), "isn't JSON") {
+		t.Errorf("Expected an error about the body, got: %v", errs)
+	}
+}
+
+func TestResponseCaptureTransform(t *testing.T) {
+	session := NewSession()
+	transform := &ResponseCaptureTransform{URLPattern: "/orders$", Path: "$.order.id", Variable: "order_id"}
+	transform.UseSession(session)
+
+	create := util.MakeRequest()
+	create.URL = "https://example.com/orders"
+	recorded := &model.Response{}
+	recorded.Content.Text = `{"order": {"id": 1001}}`
+	live := util.MakeResponse()
+	live.ContentBody = util.StringPtr(`{"order": {"id": 2002}}`)
+
+	responseTransform := transform.T(create)
+	recordedTransform, ok := responseTransform.(RecordedResponseTransform)
+	if !ok {
+		t.Fatalf("Expected the transform to want the recorded response, got: %#v", responseTransform)
+	}
+	recordedTransform.Recorded(recorded)
+	if replacement := recordedTransform.T(live); replacement != transform {
+		t.Errorf("Expected the transform to keep itself, got: %#v", replacement)
+	}
+	if orderID, _ := session.Get("order_id"); orderID != "2002" {
+		t.Errorf("Expected the live value to be stored, got: %q", orderID)
+	}
+
+	later := util.MakeRequest()
+	later.URL = "https://example.com/orders/1001?related=10012"
+	later.PostData = &model.PostData{MimeType: "application/json", Text: `{"order_id": 1001, "ids": ["1001"]}`}
+	transform.T(later)
+	if later.URL != "https://example.com/orders/2002?related=10012" {
+		t.Errorf("Expected the recorded ID to be replaced in the URL, got: %s", later.URL)
+	}
+	if later.PostData.Text != `{"order_id": 2002, "ids": ["2002"]}` || later.BodySize != len(later.PostData.Text) {
+		t.Errorf("Expected the recorded ID to be replaced in the body, got: %s", later.PostData.Text)
+	}
+
+	// Other methods aren't expected to answer with the value
+	transform.Method = "POST"
+	create.Method = "POST"
+	list := util.MakeRequest()
+	list.Method = "GET"
+	list.URL = "https://example.com/orders"
+	if _, ok := transform.T(list).(passthrough); !ok {
+		t.Errorf("Expected responses to other methods not to be read")
+	}
+
+	// A response without the value is a failure
+	live.ContentBody = util.StringPtr(`{"error": "out of stock"}`)
+	transform.T(create).T(live)
+	if errs := session.Errors(); len(errs) != 1 || !strings.Contains(errs[0].Error(), "$.order.id") {
+		t.Errorf("Expected an error about the missing value, got: %v", errs)
+	}
+}
+
+func TestResponseCaptureTransformFromAHeader(t *testing.T) {
+	transform := &ResponseCaptureTransform{Header: "Location", Pattern: `/carts/(\w+)`}
+	transform.UseSession(NewSession())
+
+	recorded := &model.Response{Headers: []model.SingleItemMap{{Key: util.StringPtr("Location"), Value: util.StringPtr("/carts/abc")}}}
+	live := &model.Response{Headers: []model.SingleItemMap{{Key: util.StringPtr("location"), Value: util.StringPtr("/carts/xyz")}}}
+	responseTransform := transform.T(util.MakeRequest()).(RecordedResponseTransform)
+	responseTransform.Recorded(recorded)
+	responseTransform.T(live)
+
+	later := util.MakeRequest()
+	later.URL = "https://example.com/carts/abc/items"
+	transform.T(later)
+	if later.URL != "https://example.com/carts/xyz/items" {
+		t.Errorf("Expected the recorded cart to be replaced, got: %s", later.URL)
+	}
+}
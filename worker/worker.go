@@ -0,0 +1,231 @@
+// The worker package pulls replay jobs off a queue.Queue, runs them with
+// HarRunners and streams the results back to the queue.
+package worker
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/JackDanger/traffic/parser"
+	"github.com/JackDanger/traffic/queue"
+	"github.com/JackDanger/traffic/runner"
+	"github.com/JackDanger/traffic/transforms"
+)
+
+// Worker performs one job at a time from its queue
+type Worker struct {
+	Name           string
+	Queue          queue.Queue
+	PollInterval   time.Duration // how long to wait when the queue is empty
+	ReportInterval time.Duration // how often to send results back while a job runs
+	HeartbeatEvery time.Duration // how often to tell the queue this worker is alive
+	logger         runner.Logger
+	logDevice      io.Writer
+}
+
+// New returns a Worker that identifies itself to the queue by name
+func New(name string, q queue.Queue, logDevice io.Writer) *Worker {
+	return &Worker{
+		Name:           name,
+		Queue:          q,
+		PollInterval:   time.Second,
+		ReportInterval: time.Second,
+		HeartbeatEvery: 5 * time.Second,
+		logger:         runner.NewLogger(name, logDevice),
+		logDevice:      logDevice,
+	}
+}
+
+// Run pulls jobs off the queue and performs them, forever
+func (w *Worker) Run() {
+	go w.heartbeat()
+	for {
+		job, err := w.Queue.Pop(w.Name)
+		if err != nil {
+			w.logger.Println("couldn't reach the queue: ", err)
+		}
+		if job == nil {
+			time.Sleep(w.PollInterval)
+			continue
+		}
+		w.logger.Println("starting job ", job.ID, " for archive ", job.ArchiveID)
+		if err := w.Perform(job); err != nil {
+			w.logger.Println("job ", job.ID, " failed: ", err)
+		}
+	}
+}
+
+// Perform replays the job's archive with the requested concurrency, sending
+// batches of results to the queue as they come in and a final report once
+// every session is finished.
+func (w *Worker) Perform(job *queue.Job) error {
+	har, err := parser.HarFrom(job.Source)
+	if err != nil {
+		return w.giveUp(job, err)
+	}
+	// Make sure every transform can be built before starting any sessions.
+	// They all share the rows of any feeders and the count of any counters.
+	feeders, counters := transforms.NewFeeders(), transforms.NewCounters()
+	if _, err := w.transformsFor(job, feeders, counters); err != nil {
+		return w.giveUp(job, err)
+	}
+
+	results := make(chan runner.Result)
+	stop := make(chan struct{}) // closed if the queue gives the job to someone else
+	sessions := sync.WaitGroup{}
+	deadline := time.Now().Add(job.Duration)
+	for i := 0; i < job.Concurrency; i++ {
+		sessions.Add(1)
+		go func(num int) {
+			defer sessions.Done()
+			name := w.Name + " " + job.ID + " #" + strconv.Itoa(num)
+			// Play through the HAR at least once and then keep starting over
+			// until the job's time is up.
+			for {
+				ts, _ := w.transformsFor(job, feeders, counters)
+				instance := runner.NewHarRunner(har, runner.NewHTTPExecutor(name, w.logDevice), ts, job.Velocity)
+				finished := make(chan struct{})
+				go func() {
+					select {
+					case <-stop:
+						instance.Kill()
+					case <-finished:
+					}
+				}()
+				runner.Collect(instance, func(result runner.Result) {
+					results <- result
+				})
+				close(finished)
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				if time.Now().After(deadline) {
+					return
+				}
+			}
+		}(i)
+	}
+	go func() {
+		sessions.Wait()
+		close(results)
+	}()
+
+	err = w.stream(job, results)
+	if err == queue.ErrAbandoned {
+		// Nobody wants the rest of the results, let the sessions wind down
+		close(stop)
+		go func() {
+			for range results {
+			}
+		}()
+	}
+	return err
+}
+
+// heartbeat lets the queue know this worker is alive, even while it's busy
+// performing a job and not asking for new ones
+func (w *Worker) heartbeat() {
+	for range time.Tick(w.HeartbeatEvery) {
+		if err := w.Queue.Heartbeat(w.Name); err != nil {
+			w.logger.Println("couldn't send a heartbeat: ", err)
+		}
+	}
+}
+
+// stream sends the results to the queue in batches until the channel closes
+func (w *Worker) stream(job *queue.Job, results chan runner.Result) error {
+	ticker := time.NewTicker(w.ReportInterval)
+	defer ticker.Stop()
+
+	batch := []runner.Result{}
+	for {
+		select {
+		case result, ok := <-results:
+			if !ok {
+				return w.finish(job, batch)
+			}
+			batch = append(batch, result)
+		case <-ticker.C:
+			if len(batch) == 0 {
+				continue
+			}
+			err := w.Queue.Report(&queue.Report{
+				JobID:   job.ID,
+				Worker:  w.Name,
+				Results: batch,
+			})
+			if err == queue.ErrAbandoned {
+				return err
+			}
+			if err != nil {
+				// Hang on to the batch and try again next tick
+				w.logger.Println("couldn't report results: ", err)
+				continue
+			}
+			batch = []runner.Result{}
+		}
+	}
+}
+
+// finish sends the last batch along with word that the job is done. Without
+// it the job never finishes, so it keeps trying until the queue takes it or
+// gives the job to someone else.
+func (w *Worker) finish(job *queue.Job, batch []runner.Result) error {
+	for {
+		err := w.Queue.Report(&queue.Report{
+			JobID:   job.ID,
+			Worker:  w.Name,
+			Results: batch,
+			Done:    true,
+		})
+		if err == nil || err == queue.ErrAbandoned {
+			return err
+		}
+		w.logger.Println("couldn't report the end of the job: ", err)
+		time.Sleep(w.ReportInterval)
+	}
+}
+
+// transformsFor builds a fresh set of transforms for a single session.
+// Transforms hold on to what they've captured so sessions can't share them.
+func (w *Worker) transformsFor(job *queue.Job, feeders *transforms.Feeders, counters *transforms.Counters) ([]transforms.RequestTransform, error) {
+	ts := []transforms.RequestTransform{}
+	for _, record := range job.Transforms {
+		transform, err := record.Model()
+		if err != nil {
+			return nil, err
+		}
+		ts = append(ts, transform)
+	}
+	if job.Target != "" {
+		target, err := transforms.NewTargetTransform(job.Target)
+		if err != nil {
+			return nil, err
+		}
+		ts = append(ts, target)
+	}
+	if err := transforms.UseFeeders(feeders, ts); err != nil {
+		return nil, err
+	}
+	transforms.UseCounters(counters, ts)
+	return ts, nil
+}
+
+// giveUp tells the queue this job can't be performed
+func (w *Worker) giveUp(job *queue.Job, err error) error {
+	reportErr := w.Queue.Report(&queue.Report{
+		JobID:  job.ID,
+		Worker: w.Name,
+		Done:   true,
+		Error:  err.Error(),
+	})
+	if reportErr != nil {
+		return fmt.Errorf("%s (and couldn't tell the queue: %s)", err, reportErr)
+	}
+	return err
+}
@@ -0,0 +1,181 @@
+package worker
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/JackDanger/traffic/model"
+	"github.com/JackDanger/traffic/parser"
+	"github.com/JackDanger/traffic/persistence"
+	"github.com/JackDanger/traffic/queue"
+	"github.com/JackDanger/traffic/util"
+)
+
+func TestPerform(t *testing.T) {
+	var hits int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		if r.Header.Get("X-Injected") != "yes" {
+			w.WriteHeader(400)
+		}
+	}))
+	defer server.Close()
+
+	entry := util.MakeEntry()
+	entry.Request.Method = "GET"
+	entry.Request.URL = "https://www.example.com/users/1"
+	source, err := parser.HarToJSON(&model.Har{Entries: []model.Entry{*entry}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	injection := persistence.Transform{
+		Type:          "HeaderInjectionTransform",
+		MarshaledJSON: `{"key": "X-Injected", "value": "yes"}`,
+	}
+
+	q := queue.NewMemoryQueue()
+	job := &queue.Job{
+		Source:      source,
+		Target:      server.URL,
+		Transforms:  []persistence.Transform{injection},
+		Velocity:    1.0,
+		Concurrency: 3,
+	}
+	if err := q.Push(job); err != nil {
+		t.Fatal(err)
+	}
+
+	w := New("test-worker", q, ioutil.Discard)
+	if err := w.Perform(job); err != nil {
+		t.Fatal(err)
+	}
+
+	if hits := atomic.LoadInt32(&hits); hits != 3 {
+		t.Errorf("Expected one request from each of 3 sessions, got: %d", hits)
+	}
+	status, err := q.Status(job.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !status.Done {
+		t.Errorf("Expected the job to be marked done")
+	}
+	if status.Summary.Requests != 3 {
+		t.Errorf("Expected 3 results to be reported, got: %d", status.Summary.Requests)
+	}
+	if status.Summary.StatusCodes[200] != 3 {
+		t.Errorf("Expected every request to be transformed and succeed, got: %#v", status.Summary.StatusCodes)
+	}
+}
+
+func TestPerformReportsBadArchives(t *testing.T) {
+	q := queue.NewMemoryQueue()
+	job := &queue.Job{Source: "not a har", Concurrency: 1}
+	if err := q.Push(job); err != nil {
+		t.Fatal(err)
+	}
+
+	w := New("test-worker", q, ioutil.Discard)
+	if err := w.Perform(job); err == nil {
+		t.Errorf("Expected an unparseable archive to fail")
+	}
+
+	status, err := q.Status(job.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !status.Done || status.Error == "" {
+		t.Errorf("Expected the failure to be reported to the queue, got: %#v", status)
+	}
+}
+
+// abandoningQueue reassigns every job as soon as any results are reported
+type abandoningQueue struct {
+	*queue.MemoryQueue
+}
+
+func (q abandoningQueue) Report(report *queue.Report) error {
+	return queue.ErrAbandoned
+}
+
+func TestPerformStopsWhenAbandoned(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	entry := util.MakeEntry()
+	entry.Request.Method = "GET"
+	source, err := parser.HarToJSON(&model.Har{Entries: []model.Entry{*entry}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := abandoningQueue{queue.NewMemoryQueue()}
+	job := &queue.Job{Source: source, Target: server.URL, Velocity: 1.0, Concurrency: 2, Duration: time.Hour}
+	if err := q.Push(job); err != nil {
+		t.Fatal(err)
+	}
+
+	w := New("test-worker", q, ioutil.Discard)
+	w.ReportInterval = 10 * time.Millisecond
+	performed := make(chan error)
+	go func() { performed <- w.Perform(job) }()
+	select {
+	case err := <-performed:
+		if err != queue.ErrAbandoned {
+			t.Errorf("Expected the worker to stop because the job was abandoned, got: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the worker to stop once the job was abandoned")
+	}
+}
+
+// flakyQueue fails the first few reports that finish a job
+type flakyQueue struct {
+	*queue.MemoryQueue
+	failures int32
+}
+
+func (q *flakyQueue) Report(report *queue.Report) error {
+	if report.Done && atomic.AddInt32(&q.failures, -1) >= 0 {
+		return errors.New("connection refused")
+	}
+	return q.MemoryQueue.Report(report)
+}
+
+func TestPerformRetriesTheFinalReport(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	entry := util.MakeEntry()
+	entry.Request.Method = "GET"
+	source, err := parser.HarToJSON(&model.Har{Entries: []model.Entry{*entry}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := &flakyQueue{MemoryQueue: queue.NewMemoryQueue(), failures: 2}
+	job := &queue.Job{Source: source, Target: server.URL, Velocity: 1.0, Concurrency: 2}
+	if err := q.Push(job); err != nil {
+		t.Fatal(err)
+	}
+
+	w := New("test-worker", q, ioutil.Discard)
+	w.ReportInterval = 10 * time.Millisecond
+	if err := w.Perform(job); err != nil {
+		t.Fatal(err)
+	}
+
+	status, err := q.Status(job.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !status.Done {
+		t.Errorf("Expected the job to be marked done once the queue was back")
+	}
+	if status.Summary.Requests != 2 {
+		t.Errorf("Expected the last batch to be sent again rather than dropped, got: %d requests", status.Summary.Requests)
+	}
+}